@@ -0,0 +1,96 @@
+// Command precompress writes gzip and brotli variants next to the compressible files of a directory,
+// so that the web server can send them as they are instead of compressing them on every request.
+//
+//	go run ./cmd/precompress ui/static
+//
+// A variant that isn't smaller than its file is removed.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/andybalholm/brotli"
+)
+
+// extensions of the files worth compressing, images and fonts are compressed already
+var compressible = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".svg":  true,
+	".ico":  true,
+	".html": true,
+	".json": true,
+	".txt":  true,
+}
+
+// variants by file extension
+var encoders = map[string]func(w io.Writer) io.WriteCloser{
+	".gz": func(w io.Writer) io.WriteCloser {
+		zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		return zw
+	},
+	".br": func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriterLevel(w, brotli.BestCompression)
+	},
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: precompress <dir>")
+		os.Exit(2)
+	}
+
+	if err := precompressDir(os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// write the variants of every compressible file under dir
+func precompressDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !compressible[filepath.Ext(path)] {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for ext, newEncoder := range encoders {
+			if err := writeVariant(path+ext, b, newEncoder); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// write b compressed to path, or remove path if compressing doesn't pay off
+func writeVariant(path string, b []byte, newEncoder func(w io.Writer) io.WriteCloser) error {
+	var buf bytes.Buffer
+	enc := newEncoder(&buf)
+	if _, err := enc.Write(b); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	if buf.Len() >= len(b) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
@@ -0,0 +1,95 @@
+//go:build integration
+
+// The ACME test obtains a certificate from a locally running Pebble test server:
+//
+//	pebble -config test/config/pebble-config.json &
+//	SNIPPETBOX_TEST_ACME_DIRECTORY=https://localhost:14000/dir \
+//	SNIPPETBOX_TEST_ACME_CA=test/certs/pebble.minica.pem \
+//	go test -tags integration -run TestACME ./cmd/web
+//
+// Pebble validates http-01 challenges on port 5002, which the test listens on.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+const (
+	testACMEDirectory = "SNIPPETBOX_TEST_ACME_DIRECTORY"
+	testACMECA        = "SNIPPETBOX_TEST_ACME_CA"
+)
+
+func TestACME(t *testing.T) {
+	dirURL := os.Getenv(testACMEDirectory)
+	if dirURL == "" {
+		t.Skipf("%s is not set", testACMEDirectory)
+	}
+
+	// trust the certificate of the ACME server itself
+	pem, err := os.ReadFile(os.Getenv(testACMECA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		t.Fatalf("no certificate in %s", os.Getenv(testACMECA))
+	}
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+
+	cfg := defaultConfig()
+	cfg.TLS.Mode = tlsModeACME
+	cfg.TLS.RedirectAddr = ":5002"
+	cfg.TLS.ACME.Domains = []string{"localhost"}
+	cfg.TLS.ACME.CacheDir = t.TempDir()
+	cfg.TLS.ACME.DirectoryURL = dirURL
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newACMEManager(cfg, httpClient)
+
+	// answer the challenges on the plain HTTP listener
+	ln, err := net.Listen("tcp", cfg.TLS.RedirectAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: m.HTTPHandler(redirectToHTTPS(cfg.Addr))}
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, slices.Contains(leaf.DNSNames, "localhost"), true)
+
+	// the certificate is cached on disk for the next start
+	entries, err := os.ReadDir(cfg.TLS.ACME.CacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries) > 0, true)
+
+	// other hosts are refused
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	assert.Equal(t, err != nil, true)
+}
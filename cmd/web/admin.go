@@ -0,0 +1,166 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// routes of the admin listener, which must not be reachable from the public internet
+func adminRoutes(app *application) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /metrics", app.metrics.handler(app.logger))
+
+	// profiling
+	// the command line isn't served, since it holds the secrets given as flags, e.g. -database-uri
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+
+	// runtime stats
+	mux.HandleFunc("GET /debug/vars", getVars)
+
+	mux.HandleFunc("GET /buildinfo", getBuildInfo(app))
+
+	return mux
+}
+
+// check that the TCP address of the admin listener only accepts connections from this host
+// its host must be localhost or a loopback address, an empty host listens on every interface
+func checkLoopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip, err := netip.ParseAddr(host); err != nil || !ip.Unmap().IsLoopback() {
+		return fmt.Errorf("must be on localhost, a loopback address or a unix socket, got %q", addr)
+	}
+	return nil
+}
+
+// listen on the address of the admin listener
+// it is a unix socket if the address starts with "unix:", e.g. "unix:/run/snippetbox/admin.sock"
+func listenAdmin(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// a socket left behind by a previous run would make the listener fail
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// only the user running the server may connect
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// publish the runtime and database stats served by /debug/vars
+// expvar has a single global registry, so it must be called once
+func publishVars(st *storage) {
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+	if st.dbPool != nil {
+		expvar.Publish("db_pool", expvar.Func(func() any {
+			stat := st.dbPool.Stat()
+			return map[string]any{
+				"acquired_conns":     stat.AcquiredConns(),
+				"idle_conns":         stat.IdleConns(),
+				"constructing_conns": stat.ConstructingConns(),
+				"total_conns":        stat.TotalConns(),
+				"max_conns":          stat.MaxConns(),
+				"acquire_count":      stat.AcquireCount(),
+				"acquire_duration":   stat.AcquireDuration().String(),
+				"empty_acquires":     stat.EmptyAcquireCount(),
+				"canceled_acquires":  stat.CanceledAcquireCount(),
+			}
+		}))
+	}
+	if st.db != nil {
+		expvar.Publish("db", expvar.Func(func() any {
+			return st.db.Stats()
+		}))
+	}
+}
+
+// serve the published variables as JSON like expvar.Handler, except the command line
+func getVars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	fmt.Fprint(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprint(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprint(w, "\n}\n")
+}
+
+// buildInfo describes the binary that is running
+type buildInfo struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Version   string            `json:"version"`
+	Settings  map[string]string `json:"settings"`
+	Deps      map[string]string `json:"deps"`
+}
+
+// serve the version of the binary, the VCS revision it was built from and its dependencies
+func getBuildInfo(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			app.serverError(w, r, "build info isn't available")
+			return
+		}
+
+		info := buildInfo{
+			GoVersion: bi.GoVersion,
+			Path:      bi.Main.Path,
+			Version:   bi.Main.Version,
+			Settings:  make(map[string]string, len(bi.Settings)),
+			Deps:      make(map[string]string, len(bi.Deps)),
+		}
+		for _, s := range bi.Settings {
+			info.Settings[s.Key] = s.Value
+		}
+		for _, dep := range bi.Deps {
+			version := dep.Version
+			if dep.Replace != nil {
+				version = dep.Replace.Path + " " + dep.Replace.Version
+			}
+			info.Deps[dep.Path] = version
+		}
+
+		if err := writeJSON(w, http.StatusOK, info); err != nil {
+			app.logger.ErrorContext(r.Context(), err.Error())
+		}
+	}
+}
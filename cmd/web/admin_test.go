@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+func TestAdminRoutes(t *testing.T) {
+	app := newTestApplication(t)
+	public := newTestServer(t, handler(app))
+
+	tests := []struct {
+		urlPath  string
+		wantBody string
+	}{
+		{urlPath: "/metrics", wantBody: "snippetbox_signups_total"},
+		{urlPath: "/debug/pprof/", wantBody: "goroutine"},
+		{urlPath: "/debug/vars", wantBody: `"memstats"`},
+		{urlPath: "/buildinfo", wantBody: `"go_version"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.urlPath, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			adminRoutes(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.urlPath, nil))
+			assert.Equal(t, rr.Code, http.StatusOK)
+			assert.Equal(t, strings.Contains(rr.Body.String(), tt.wantBody), true)
+
+			// the public routes don't serve them
+			code, _, _ := public.get(t, tt.urlPath)
+			assert.Equal(t, code, http.StatusNotFound)
+		})
+	}
+}
+
+func TestAdminRoutesCommandLine(t *testing.T) {
+	app := newTestApplication(t)
+
+	// the command line holds the secrets given as flags
+	rr := httptest.NewRecorder()
+	adminRoutes(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil))
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+
+	rr = httptest.NewRecorder()
+	adminRoutes(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	_, ok := vars["memstats"]
+	assert.Equal(t, ok, true)
+	_, ok = vars["cmdline"]
+	assert.Equal(t, ok, false)
+}
+
+func TestBuildInfo(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	adminRoutes(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/buildinfo", nil))
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "application/json")
+
+	var info buildInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.HasPrefix(info.GoVersion, "go"), true)
+	_, ok := info.Deps["github.com/jackc/pgx/v5"]
+	assert.Equal(t, ok, true)
+}
+
+func TestListenAdminUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	// a socket left behind by a previous run is replaced
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := listenAdmin("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(adminRoutes(newTestApplication(t)))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fi.Mode().Perm(), os.FileMode(0o600))
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	res, err := client.Get("http://admin/buildinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ := readResponse(t, res)
+	assert.Equal(t, code, http.StatusOK)
+}
@@ -5,38 +5,74 @@ import (
 	"context"
 	"html/template"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/obzva/snippetbox/internal/model"
+	"github.com/obzva/snippetbox/internal/sso"
+	"github.com/obzva/snippetbox/internal/validator"
 )
 
 const (
-	keyMethod = "method"
-	keyURI    = "uri"
+	keyMethod    = "method"
+	keyPath      = "path"
+	keyRequestID = "request_id"
 	// keyTrace  = "trace"
 )
 
 // application holds the application-wide dependencies and configuration
 // and provides some useful helpers
 type application struct {
-	logger         *slog.Logger
-	snippetModel   *model.SnippetModel
-	userModel      *model.UserModel
-	templateCache  map[string]*template.Template
-	sessionManager *scs.SessionManager
+	logger           *slog.Logger
+	snippetModel     model.SnippetStore
+	userModel        model.UserStore
+	userSessionModel model.UserSessionStore
+	templateCache    map[string]*template.Template
+	sessionManager   *scs.SessionManager
+	// single sign-on identity provider, nil if single sign-on is disabled
+	ssoProvider *sso.Provider
+	// whether a user signing in through single sign-on for the first time gets a new account
+	ssoAutoProvision bool
+	// passwords that appeared in data breaches, nil if no list is loaded
+	breachedPasswords *validator.BreachedPasswords
+	// how long a signed-in session without "remember me" may be inactive
+	sessionIdleTimeout time.Duration
+	// how long a signed-in session with "remember me" lasts
+	rememberMeLifetime time.Duration
+	// fraction of the served requests that are logged
+	accessLogSampleRatio float64
+	metrics              *metrics
+	health               *health
+	// token buckets of the rate limiter, nil if rate limiting is disabled
+	rateLimits model.RateLimitStore
+	// proxies whose forwarding header is believed
+	trustedProxies []netip.Prefix
+	// forwarding header set by the trusted proxies
+	trustedHeader string
+	// fingerprinted static files
+	assets *assets
 }
 
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, msg string, attrs ...any) {
 	method := r.Method
-	uri := r.URL.RequestURI()
+	// the query isn't logged since it may hold secrets, e.g. the code of the single sign-on callback
+	path := r.URL.Path
 	// trace := string(debug.Stack())
 
-	// attrs = append(attrs, slog.String(keyMethod, method), slog.String(keyURI, uri), slog.String(keyTrace, trace))
-	attrs = append(attrs, slog.String(keyMethod, method), slog.String(keyURI, uri))
-	app.logger.Error(msg, attrs...)
+	// attrs = append(attrs, slog.String(keyMethod, method), slog.String(keyPath, path), slog.String(keyTrace, trace))
+	id := requestID(r.Context())
+	attrs = append(attrs, slog.String(keyMethod, method), slog.String(keyPath, path), slog.String(keyRequestID, id))
+	app.logger.ErrorContext(r.Context(), msg, attrs...)
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	// users can quote the request ID to find the log line of the error
+	body := http.StatusText(http.StatusInternalServerError)
+	if id != "" {
+		body += "\nrequest ID: " + id
+	}
+	http.Error(w, body, http.StatusInternalServerError)
 }
 
 func (app *application) clientError(w http.ResponseWriter, statusCode int) {
@@ -50,12 +86,16 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, statusCod
 		return
 	}
 
+	_, span := tracer.Start(r.Context(), "render "+page)
+	defer span.End()
+
 	// buffer for trial render
 	// it helps us to catch runtime error
 	// if trial render onto this buffer succeed then we redner the content onto http.ResponseWriter
 	var b bytes.Buffer
 
 	if err := ts.ExecuteTemplate(&b, "base", data); err != nil {
+		recordSpanError(span, err)
 		app.serverError(w, r, err.Error())
 		return
 	}
@@ -63,7 +103,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, statusCod
 	w.WriteHeader(statusCode)
 
 	if _, err := b.WriteTo(w); err != nil {
-		app.logger.Error(err.Error())
+		app.logger.ErrorContext(r.Context(), err.Error())
 	}
 }
 
@@ -74,3 +114,67 @@ func (app *application) checkAuthenticated(ctx context.Context) bool {
 	}
 	return authenticated
 }
+
+// renew the session token and record a new signed-in session for the user
+// if rememberMe is true, the session cookie outlives the browser session
+func (app *application) startUserSession(r *http.Request, userID int, rememberMe bool) error {
+	ctx := r.Context()
+
+	if err := app.sessionManager.RenewToken(ctx); err != nil {
+		return err
+	}
+
+	app.sessionManager.RememberMe(ctx, rememberMe)
+	if rememberMe {
+		app.sessionManager.SetDeadline(ctx, time.Now().Add(app.rememberMeLifetime).UTC())
+	}
+
+	// the signed-in session lasts as long as the session cookie
+	sessionID, err := app.userSessionModel.Insert(ctx, userID, r.UserAgent(), remoteIP(r), app.sessionManager.Deadline(ctx))
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(ctx, sessionKeyAuth, userID)
+	app.sessionManager.Put(ctx, sessionKeySessionID, sessionID)
+	app.sessionManager.Put(ctx, sessionKeyRememberMe, rememberMe)
+
+	return nil
+}
+
+// renew the session token and revoke the signed-in session of the current user
+// the session turns back into a browser session with the default lifetime
+func (app *application) endUserSession(r *http.Request) error {
+	ctx := r.Context()
+
+	if err := app.sessionManager.RenewToken(ctx); err != nil {
+		return err
+	}
+
+	userID := app.sessionManager.GetInt(ctx, sessionKeyAuth)
+	sessionID := app.sessionManager.GetString(ctx, sessionKeySessionID)
+	if err := app.userSessionModel.Revoke(ctx, sessionID, userID); err != nil {
+		return err
+	}
+
+	app.sessionManager.Remove(ctx, sessionKeyAuth)
+	app.sessionManager.Remove(ctx, sessionKeySessionID)
+	app.sessionManager.Remove(ctx, sessionKeyRememberMe)
+	app.sessionManager.RememberMe(ctx, false)
+	app.sessionManager.SetDeadline(ctx, time.Now().Add(app.sessionManager.Lifetime).UTC())
+
+	return nil
+}
+
+// return the IP address of the client without the port number
+// it is the one resolved by resolveClientIP, if the request went through it
+func remoteIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxKeyClientIP).(string); ok {
+		return ip
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
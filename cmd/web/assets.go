@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// assets fingerprints the static files with their content hash
+// so that a fingerprinted URL never changes content and can be cached forever
+type assets struct {
+	fsys fs.FS
+	// content hash by file name, e.g. "static/css/main.css"
+	hashes map[string]string
+	// file name by fingerprinted name, e.g. "static/css/main.1a2b3c4d5e6f7a8b.css"
+	originals map[string]string
+	// hash of every file of fsys, the templates included
+	// it changes whenever a page could render differently
+	version string
+	// when the files were loaded, embedded files have no modification time of their own
+	// pages rendered with them haven't changed before
+	loaded time.Time
+}
+
+// hash the static files of fsys, their precompressed variants excluded
+func newAssets(fsys fs.FS) (*assets, error) {
+	a := &assets{
+		fsys:      fsys,
+		hashes:    make(map[string]string),
+		originals: make(map[string]string),
+		loaded:    time.Now().UTC(),
+	}
+
+	err := fs.WalkDir(fsys, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isPrecompressedVariant(name) {
+			return nil
+		}
+
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		hash := hex.EncodeToString(sum[:8])
+
+		a.hashes[name] = hash
+		a.originals[fingerprint(name, hash)] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// fs.WalkDir walks in lexical order, so the version doesn't depend on the order of the files
+	h := sha256.New()
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(b))
+		h.Write(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.version = hex.EncodeToString(h.Sum(nil)[:8])
+
+	return a, nil
+}
+
+// report whether name is a variant written by go generate, e.g. main.css.br
+func isPrecompressedVariant(name string) bool {
+	for _, ext := range precompressedExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// insert the hash before the extension of name, e.g. main.css becomes main.<hash>.css
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// return the fingerprinted URL of the static file, e.g. "css/main.css" becomes "/static/css/main.<hash>.css"
+// it is the asset template function, so that a missing file fails the render instead of linking nowhere
+func (a *assets) url(name string) (string, error) {
+	name = path.Join("static", name)
+	hash, ok := a.hashes[name]
+	if !ok {
+		return "", fmt.Errorf("asset %q doesn't exist", name)
+	}
+	return "/" + fingerprint(name, hash), nil
+}
+
+// serve the static files, or their precompressed variants if the client accepts them
+// fingerprinted URLs are cached forever, the others are revalidated with their ETag
+func serveStatic(a *assets) http.Handler {
+	fileServer := http.FileServerFS(a.fsys)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if original, ok := a.originals[name]; ok {
+			name = original
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+
+		hash, ok := a.hashes[name]
+		if !ok {
+			// directories and missing files
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+
+		// the representation depends on the Accept-Encoding header if there is a variant
+		for _, ext := range precompressedExts {
+			if _, err := fs.Stat(a.fsys, name+ext); err == nil {
+				w.Header().Add("Vary", "Accept-Encoding")
+				break
+			}
+		}
+
+		// the type is the one of the file, not of its variant
+		if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+
+		for _, encoding := range acceptedEncodings(r.Header.Get("Accept-Encoding")) {
+			if serveAssetFile(w, r, a.fsys, name, hash, encoding) {
+				return
+			}
+		}
+		if !serveAssetFile(w, r, a.fsys, name, hash, "") {
+			fileServer.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serve the file of fsys, or its precompressed variant for the content coding if it isn't empty,
+// and report whether it could be opened
+// the ETag of every variant is different since they differ byte for byte
+func serveAssetFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, name, hash, encoding string) bool {
+	file, etag := name, `"`+hash+`"`
+	if encoding != "" {
+		ext := precompressedExts[encoding]
+		file = name + ext
+		etag = `"` + hash + "-" + strings.TrimPrefix(ext, ".") + `"`
+	}
+
+	f, err := fsys.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		return false
+	}
+
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, path.Base(name), fi.ModTime(), rs)
+	return true
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+	"github.com/obzva/snippetbox/ui"
+)
+
+func newTestAssets(t *testing.T) *assets {
+	t.Helper()
+
+	a, err := newAssets(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAssetURL(t *testing.T) {
+	a := newTestAssets(t)
+
+	url, err := a.url("css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, regexp.MustCompile(`^/static/css/main\.[0-9a-f]{16}\.css$`).MatchString(url), true)
+
+	_, err = a.url("css/missing.css")
+	assert.Equal(t, err != nil, true)
+}
+
+func TestServeStatic(t *testing.T) {
+	a := newTestAssets(t)
+	css, err := fs.ReadFile(ui.Files, "static/css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	png, err := fs.ReadFile(ui.Files, "static/img/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cssURL, err := a.url("css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cssHash := a.hashes["static/css/main.css"]
+
+	tests := []struct {
+		name             string
+		urlPath          string
+		acceptEncoding   string
+		wantCacheControl string
+		wantETag         string
+		wantEncoding     string
+		wantVary         bool
+		wantType         string
+		wantBody         string
+	}{
+		{
+			name:             "Fingerprinted brotli",
+			urlPath:          cssURL,
+			acceptEncoding:   "gzip, br",
+			wantCacheControl: "public, max-age=31536000, immutable",
+			wantETag:         `"` + cssHash + `-br"`,
+			wantEncoding:     "br",
+			wantVary:         true,
+			wantType:         "text/css; charset=utf-8",
+			wantBody:         string(css),
+		},
+		{
+			name:             "Fingerprinted gzip",
+			urlPath:          cssURL,
+			acceptEncoding:   "gzip",
+			wantCacheControl: "public, max-age=31536000, immutable",
+			wantETag:         `"` + cssHash + `-gz"`,
+			wantEncoding:     "gzip",
+			wantVary:         true,
+			wantType:         "text/css; charset=utf-8",
+			wantBody:         string(css),
+		},
+		{
+			name:             "Fingerprinted identity",
+			urlPath:          cssURL,
+			acceptEncoding:   "",
+			wantCacheControl: "public, max-age=31536000, immutable",
+			wantETag:         `"` + cssHash + `"`,
+			wantEncoding:     "",
+			wantVary:         true,
+			wantType:         "text/css; charset=utf-8",
+			wantBody:         string(css),
+		},
+		{
+			name:             "Plain URL",
+			urlPath:          "/static/css/main.css",
+			acceptEncoding:   "br",
+			wantCacheControl: "no-cache",
+			wantETag:         `"` + cssHash + `-br"`,
+			wantEncoding:     "br",
+			wantVary:         true,
+			wantType:         "text/css; charset=utf-8",
+			wantBody:         string(css),
+		},
+		{
+			name:             "No variant",
+			urlPath:          "/static/img/logo.png",
+			acceptEncoding:   "br",
+			wantCacheControl: "no-cache",
+			wantETag:         `"` + a.hashes["static/img/logo.png"] + `"`,
+			wantEncoding:     "",
+			wantVary:         false,
+			wantType:         "image/png",
+			wantBody:         string(png),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.urlPath, nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			serveStatic(a).ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, http.StatusOK)
+			assert.Equal(t, rr.Header().Get("Cache-Control"), tt.wantCacheControl)
+			assert.Equal(t, rr.Header().Get("ETag"), tt.wantETag)
+			assert.Equal(t, rr.Header().Get("Content-Encoding"), tt.wantEncoding)
+			assert.Equal(t, rr.Header().Get("Vary") == "Accept-Encoding", tt.wantVary)
+			assert.Equal(t, rr.Header().Get("Content-Type"), tt.wantType)
+			assert.Equal(t, decodeBody(t, tt.wantEncoding, rr.Body.Bytes()), tt.wantBody)
+
+			// the ETag revalidates the file
+			rr = httptest.NewRecorder()
+			req.Header.Set("If-None-Match", tt.wantETag)
+			serveStatic(a).ServeHTTP(rr, req)
+			assert.Equal(t, rr.Code, http.StatusNotModified)
+		})
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		serveStatic(a).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/static/css/main.0123456789abcdef.css", nil))
+		assert.Equal(t, rr.Code, http.StatusNotFound)
+	})
+}
+
+func TestBaseTemplateLinksFingerprintedAssets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	_, _, body := ts.get(t, "/")
+	for _, name := range []string{"css/main.css", "img/favicon.ico", "js/main.js"} {
+		url, err := app.assets.url(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strings.Contains(body, url), true)
+	}
+}
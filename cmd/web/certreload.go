@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// certReloader serves the certificate in a pair of files and reloads it when they change
+// the old certificate is kept if a reload fails
+type certReloader struct {
+	logger   *slog.Logger
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+
+	mu sync.Mutex
+	// modification times of the files when they were last loaded
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// load the certificate in certFile and keyFile
+func newCertReloader(logger *slog.Logger, certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		logger:   logger,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// return the current certificate, meant for tls.Config.GetCertificate
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.cert.Load(), nil
+}
+
+// load the certificate files and swap in the certificate
+func (cr *certReloader) reload() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	certModTime, keyModTime, err := cr.modTimes()
+	if err != nil {
+		return err
+	}
+	// a failed load isn't retried until the files change again
+	cr.certModTime, cr.keyModTime = certModTime, keyModTime
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.cert.Store(&cert)
+	return nil
+}
+
+// reload the certificate if either file has changed since it was last loaded
+// report whether the files have changed
+func (cr *certReloader) reloadIfChanged() (bool, error) {
+	cr.mu.Lock()
+	certModTime, keyModTime, err := cr.modTimes()
+	changed := err == nil && (!certModTime.Equal(cr.certModTime) || !keyModTime.Equal(cr.keyModTime))
+	cr.mu.Unlock()
+	if err != nil || !changed {
+		return false, err
+	}
+
+	return true, cr.reload()
+}
+
+func (cr *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// return a worker that checks the files every interval and reloads the certificate on every signal of hup
+// the files are only checked on a signal if interval is zero
+func (cr *certReloader) watch(interval time.Duration, hup <-chan os.Signal) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := cr.reload(); err != nil {
+					cr.logger.Error("failed to reload certificate, keeping the old one", slog.String("error", err.Error()))
+					continue
+				}
+				cr.logger.Info("reloaded certificate", slog.String("cert-file", cr.certFile))
+			case <-tick:
+				changed, err := cr.reloadIfChanged()
+				if err != nil {
+					cr.logger.Error("failed to reload certificate, keeping the old one", slog.String("error", err.Error()))
+					continue
+				}
+				if changed {
+					cr.logger.Info("reloaded certificate", slog.String("cert-file", cr.certFile))
+				}
+			}
+		}
+	}
+}
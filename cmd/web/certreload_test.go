@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+// write a self-signed certificate for the common name cn to certFile and its key to keyFile
+// the modification time of both files is set to modTime
+func writeTestCert(t *testing.T, certFile, keyFile, cn string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, modTime, certFile, keyFile)
+}
+
+func touch(t *testing.T, modTime time.Time, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// return the common name of the certificate currently served by cr
+func servedCommonName(t *testing.T, cr *certReloader) string {
+	t.Helper()
+
+	cert, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+
+	writeTestCert(t, certFile, keyFile, "old.example.com", modTime)
+	cr, err := newCertReloader(slog.New(slog.DiscardHandler), certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, servedCommonName(t, cr), "old.example.com")
+
+	// nothing changed
+	changed, err := cr.reloadIfChanged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, changed, false)
+
+	// rotated files are picked up
+	modTime = modTime.Add(time.Minute)
+	writeTestCert(t, certFile, keyFile, "new.example.com", modTime)
+	changed, err = cr.reloadIfChanged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, changed, true)
+	assert.Equal(t, servedCommonName(t, cr), "new.example.com")
+
+	// a broken certificate is rejected and the old one is kept
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modTime = modTime.Add(time.Minute)
+	touch(t, modTime, certFile)
+	changed, err = cr.reloadIfChanged()
+	assert.Equal(t, changed, true)
+	assert.Equal(t, err != nil, true)
+	assert.Equal(t, servedCommonName(t, cr), "new.example.com")
+
+	// the failed files aren't loaded again until they change
+	changed, err = cr.reloadIfChanged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, changed, false)
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+
+	writeTestCert(t, certFile, keyFile, "old.example.com", modTime)
+	cr, err := newCertReloader(slog.New(slog.DiscardHandler), certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lc := newLifecycle(slog.New(slog.DiscardHandler))
+	lc.start("reload-certificate", cr.watch(time.Millisecond, nil))
+	t.Cleanup(func() {
+		lc.stop(context.Background())
+	})
+
+	writeTestCert(t, certFile, keyFile, "new.example.com", modTime.Add(time.Minute))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCommonName(t, cr) != "new.example.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate wasn't reloaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCertReloaderWatchSignal(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+
+	writeTestCert(t, certFile, keyFile, "old.example.com", modTime)
+	cr, err := newCertReloader(slog.New(slog.DiscardHandler), certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files are only checked on a signal
+	hup := make(chan os.Signal, 1)
+	lc := newLifecycle(slog.New(slog.DiscardHandler))
+	lc.start("reload-certificate", cr.watch(0, hup))
+	t.Cleanup(func() {
+		lc.stop(context.Background())
+	})
+
+	// a signal reloads the files even if their modification times haven't changed
+	writeTestCert(t, certFile, keyFile, "new.example.com", modTime)
+	hup <- syscall.SIGHUP
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCommonName(t, cr) != "new.example.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate wasn't reloaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// forwarding headers a trusted proxy may set
+const (
+	trustedHeaderForwarded     = "forwarded"
+	trustedHeaderXForwardedFor = "x-forwarded-for"
+	trustedHeaderXRealIP       = "x-real-ip"
+)
+
+// resolve the IP address of the client and store it in the context for remoteIP
+// the forwarding header is believed only when the request comes from a trusted proxy,
+// and only as far back as the chain of trusted proxies goes
+func resolveClientIP(app *application) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := peerIP(r)
+			if ip.IsValid() && app.trustedProxy(ip) {
+				ip = forwardedClientIP(r.Header, app.trustedHeader, ip, app.trustedProxy)
+			}
+
+			if ip.IsValid() {
+				ctx := context.WithValue(r.Context(), ctxKeyClientIP, ip.String())
+				r = r.WithContext(ctx)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// report whether ip belongs to a trusted proxy
+func (app *application) trustedProxy(ip netip.Addr) bool {
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// return the IP address of the peer the request came from, invalid if it isn't an IP address, e.g. a unix socket
+func peerIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
+
+// return the client IP address forwarded to the trusted proxy with this IP address
+// only the header the proxies set is read, a client can send the others to forge its address
+// the hops are walked from the closest one, and the first hop that isn't trusted is the client
+func forwardedClientIP(h http.Header, header string, proxy netip.Addr, trusted func(netip.Addr) bool) netip.Addr {
+	var hops []string
+	switch header {
+	case trustedHeaderForwarded:
+		hops = forwardedFor(h.Values("Forwarded"))
+	case trustedHeaderXForwardedFor:
+		for _, v := range h.Values("X-Forwarded-For") {
+			for hop := range strings.SplitSeq(v, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	case trustedHeaderXRealIP:
+		if v := h.Get("X-Real-IP"); v != "" {
+			hops = []string{strings.TrimSpace(v)}
+		}
+	}
+
+	client := proxy
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseHop(hops[i])
+		if !ok {
+			// the hops before an obfuscated or forged one can't be believed
+			break
+		}
+		client = ip
+		if !trusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// return the "for" parameters of the elements of RFC 7239 Forwarded headers in order
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for elem := range strings.SplitSeq(v, ",") {
+			for pair := range strings.SplitSeq(elem, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parse a hop of a forwarding header, which may have a port number and brackets around an IPv6 address
+func parseHop(hop string) (netip.Addr, bool) {
+	if ap, err := netip.ParseAddrPort(hop); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	ip, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		// forwarding header set by the trusted proxies, X-Forwarded-For if empty
+		trustedHeader string
+		header        http.Header
+		want          string
+	}{
+		{
+			name:       "Direct",
+			remoteAddr: "203.0.113.7:51000",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Untrusted peer",
+			remoteAddr: "203.0.113.7:51000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For",
+			remoteAddr: "10.0.0.2:51000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For through trusted hops",
+			remoteAddr: "10.0.0.2:51000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7", "10.0.0.3"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For of trusted hops only",
+			remoteAddr: "10.0.0.2:51000",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.4, 10.0.0.3"}},
+			want:       "10.0.0.4",
+		},
+		{
+			name:       "Garbage hop",
+			remoteAddr: "10.0.0.2:51000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, not-an-ip, 10.0.0.3"}},
+			want:       "10.0.0.3",
+		},
+		{
+			name:          "X-Real-IP",
+			remoteAddr:    "10.0.0.2:51000",
+			trustedHeader: trustedHeaderXRealIP,
+			header:        http.Header{"X-Real-Ip": {"203.0.113.7"}},
+			want:          "203.0.113.7",
+		},
+		{
+			name:       "X-Real-IP not trusted",
+			remoteAddr: "10.0.0.2:51000",
+			header:     http.Header{"X-Real-Ip": {"198.51.100.1"}},
+			want:       "10.0.0.2",
+		},
+		{
+			name:          "Forwarded",
+			remoteAddr:    "10.0.0.2:51000",
+			trustedHeader: trustedHeaderForwarded,
+			header: http.Header{
+				"Forwarded":       {`for=198.51.100.1;proto=https, For="[2001:db8:cafe::17]:4711"`},
+				"X-Forwarded-For": {"192.0.2.1"},
+			},
+			want: "2001:db8:cafe::17",
+		},
+		{
+			name:          "Forwarded with port",
+			remoteAddr:    "10.0.0.2:51000",
+			trustedHeader: trustedHeaderForwarded,
+			header:        http.Header{"Forwarded": {`for="203.0.113.7:47011"`}},
+			want:          "203.0.113.7",
+		},
+		{
+			name:          "Forwarded obfuscated",
+			remoteAddr:    "10.0.0.2:51000",
+			trustedHeader: trustedHeaderForwarded,
+			header:        http.Header{"Forwarded": {"for=_hidden"}},
+			want:          "10.0.0.2",
+		},
+		{
+			name:       "Forwarded not trusted",
+			remoteAddr: "10.0.0.2:51000",
+			header: http.Header{
+				"Forwarded":       {"for=198.51.100.1"},
+				"X-Forwarded-For": {"203.0.113.7"},
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:          "X-Forwarded-For not trusted",
+			remoteAddr:    "10.0.0.2:51000",
+			trustedHeader: trustedHeaderForwarded,
+			header:        http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:          "10.0.0.2",
+		},
+		{
+			name:       "Trusted IPv6 proxy",
+			remoteAddr: "[::1]:51000",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			want:       "203.0.113.7",
+		},
+	}
+
+	app := newTestApplication(t)
+	app.trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = remoteIP(r)
+			})
+
+			app.trustedHeader = tt.trustedHeader
+			if app.trustedHeader == "" {
+				app.trustedHeader = trustedHeaderXForwardedFor
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header = tt.header
+			resolveClientIP(app)(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cmp"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// content codings, in order of preference
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// responses smaller than this aren't worth compressing
+const minCompressSize = 1024
+
+// file extensions of the precompressed variants by content coding
+var precompressedExts = map[string]string{
+	encodingBrotli: ".br",
+	encodingGzip:   ".gz",
+}
+
+// media types of the responses that are compressed on the fly
+var compressibleTypes = map[string]bool{
+	"text/html":        true,
+	"application/json": true,
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		zw, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return zw
+	}}
+	brotliWriters = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}}
+)
+
+// return the content codings the client accepts, most preferred first
+func acceptedEncodings(acceptEncoding string) []string {
+	q := make(map[string]float64)
+	wildcard := 0.0
+	for elem := range strings.SplitSeq(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(elem), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			weight = f
+		}
+
+		switch coding {
+		case encodingBrotli, encodingGzip:
+			q[coding] = weight
+		case "*":
+			wildcard = weight
+		}
+	}
+	// codings that aren't listed get the weight of the wildcard
+	for _, c := range []string{encodingBrotli, encodingGzip} {
+		if _, ok := q[c]; !ok {
+			q[c] = wildcard
+		}
+	}
+
+	var codings []string
+	for _, c := range []string{encodingBrotli, encodingGzip} {
+		if q[c] > 0 {
+			codings = append(codings, c)
+		}
+	}
+	// brotli wins ties
+	slices.SortStableFunc(codings, func(a, b string) int {
+		return cmp.Compare(q[b], q[a])
+	})
+	return codings
+}
+
+// compress the HTML and JSON responses with the content coding the client prefers
+// small responses and the ones that are encoded already are sent as they are
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+		if len(encodings) == 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encodings[0], status: http.StatusOK}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds the response back until it knows whether to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	// body written before the decision
+	buf     []byte
+	decided bool
+	// nil if the response isn't compressed
+	enc io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	// informational responses are followed by the final one
+	if code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !cw.decided {
+		cw.status = code
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= minCompressSize {
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// send the header and the body held back so far, compressed or not
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if compressibleTypes[mediaType] {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	compress := compressibleTypes[mediaType] &&
+		h.Get("Content-Encoding") == "" &&
+		len(cw.buf) >= minCompressSize &&
+		cw.status != http.StatusNoContent &&
+		cw.status != http.StatusNotModified
+	if !compress {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+		return err
+	}
+
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	switch cw.encoding {
+	case encodingBrotli:
+		bw := brotliWriters.Get().(*brotli.Writer)
+		bw.Reset(cw.ResponseWriter)
+		cw.enc = bw
+	default:
+		zw := gzipWriters.Get().(*gzip.Writer)
+		zw.Reset(cw.ResponseWriter)
+		cw.enc = zw
+	}
+
+	_, err := cw.enc.Write(cw.buf)
+	cw.buf = nil
+	return err
+}
+
+// send the rest of the response once the handler returns
+func (cw *compressWriter) close() error {
+	if !cw.decided {
+		return cw.decide()
+	}
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(enc)
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	}
+	cw.enc = nil
+	return err
+}
+
+// send what has been written so far, e.g. for streamed responses
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// let http.ResponseController reach the underlying response writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/obzva/snippetbox/internal/assert"
+	"github.com/obzva/snippetbox/ui"
+)
+
+// decode the body of a response with its content coding
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var r io.Reader = bytes.NewReader(body)
+	switch encoding {
+	case encodingBrotli:
+		r = brotli.NewReader(r)
+	case encodingGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestAcceptedEncodings(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{header: "", want: nil},
+		{header: "identity", want: nil},
+		{header: "gzip, deflate, br, zstd", want: []string{"br", "gzip"}},
+		{header: "gzip;q=1.0, br;q=0.5", want: []string{"gzip", "br"}},
+		{header: "br;q=0, gzip", want: []string{"gzip"}},
+		{header: "*", want: []string{"br", "gzip"}},
+		{header: "gzip;q=0.2, *;q=0.5", want: []string{"br", "gzip"}},
+		{header: "GZIP", want: []string{"gzip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got := acceptedEncodings(tt.header)
+			assert.Equal(t, slices.Equal(got, tt.want), true)
+		})
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	page := "<!doctype html><html><body>" + strings.Repeat("<p>An old silent pond...</p>", 100) + "</body></html>"
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantEncoding   string
+		wantVary       bool
+	}{
+		{name: "Brotli", acceptEncoding: "gzip, br", body: page, wantEncoding: "br", wantVary: true},
+		{name: "Gzip", acceptEncoding: "gzip", body: page, wantEncoding: "gzip", wantVary: true},
+		{name: "JSON", acceptEncoding: "gzip", contentType: "application/json", body: `{"content":"` + strings.Repeat("a", 2000) + `"}`, wantEncoding: "gzip", wantVary: true},
+		{name: "Not accepted", acceptEncoding: "", body: page, wantEncoding: "", wantVary: false},
+		{name: "Small body", acceptEncoding: "br", body: "<p>OK</p>", wantEncoding: "", wantVary: true},
+		{name: "Other type", acceptEncoding: "br", contentType: "image/png", body: strings.Repeat("a", 2000), wantEncoding: "", wantVary: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(http.StatusTeapot)
+				// written in pieces like templates do
+				for chunk := range slices.Chunk([]byte(tt.body), 100) {
+					w.Write(chunk)
+				}
+			})
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			compressResponses(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, http.StatusTeapot)
+			assert.Equal(t, rr.Header().Get("Content-Encoding"), tt.wantEncoding)
+			assert.Equal(t, rr.Header().Get("Vary") == "Accept-Encoding", tt.wantVary)
+			assert.Equal(t, decodeBody(t, tt.wantEncoding, rr.Body.Bytes()), tt.body)
+		})
+	}
+}
+
+// the variants must be regenerated with go generate whenever a static file changes
+func TestPrecompressedVariantsUpToDate(t *testing.T) {
+	err := fs.WalkDir(ui.Files, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		for encoding, ext := range precompressedExts {
+			original, ok := strings.CutSuffix(name, ext)
+			if !ok {
+				continue
+			}
+
+			want, err := fs.ReadFile(ui.Files, original)
+			if err != nil {
+				t.Errorf("%s has no original file", name)
+				continue
+			}
+			variant, err := fs.ReadFile(ui.Files, name)
+			if err != nil {
+				return err
+			}
+			if decodeBody(t, encoding, variant) != string(want) {
+				t.Errorf("%s is out of date, run go generate ./ui", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/justinas/nosurf"
+)
+
+// set the validators of the response and report whether the copy of the client is still fresh,
+// in which case 304 Not Modified has been sent and nothing else must be written
+// If-None-Match takes precedence over If-Modified-Since, as in RFC 9110
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	// private since pages depend on the user, no-cache so that they are revalidated every time
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	fresh := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		fresh = etagMatches(inm, etag)
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		// the header has a resolution of a second
+		fresh = err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	if !fresh {
+		return false
+	}
+
+	// the headers describing the body don't apply to a 304
+	w.Header().Del("Content-Type")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// report whether the If-None-Match header matches etag with the weak comparison, as GET requires
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// return a weak ETag of the page rendered for the request from td and the parts it is made of,
+// false if the page can't be cached
+// it covers everything the page depends on besides td: the templates, the static files and the CSRF cookie
+// it is weak since the bodies differ byte for byte, by the masking of the form tokens and by the content coding
+func pageETag(app *application, r *http.Request, td templateData, parts ...any) (string, bool) {
+	// a flash message is shown once only
+	if td.Flash != "" {
+		return "", false
+	}
+	// the form tokens are masked differently every time, but they are all derived from the cookie
+	// without one, a new cookie is sent along with the page and the page can't be reused
+	c, err := r.Cookie(nosurf.CookieName)
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%q\x00%d\x00%t\x00%t\n", app.assets.version, c.Value, td.CurrentYear, td.Authenticated, td.SSOEnabled)
+	for _, part := range parts {
+		fmt.Fprintf(h, "%#v\x00", part)
+	}
+
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, true
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	const etag = `W/"abc"`
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 600, time.UTC)
+
+	tests := []struct {
+		name     string
+		method   string
+		header   map[string]string
+		wantCode int
+	}{
+		{
+			name:     "No validators",
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Matching ETag",
+			method:   http.MethodGet,
+			header:   map[string]string{"If-None-Match": `"abc"`},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "Matching ETag in a list",
+			method:   http.MethodGet,
+			header:   map[string]string{"If-None-Match": `"xyz", W/"abc"`},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "Wildcard",
+			method:   http.MethodHead,
+			header:   map[string]string{"If-None-Match": "*"},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "Stale ETag",
+			method:   http.MethodGet,
+			header:   map[string]string{"If-None-Match": `"xyz"`},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Stale ETag takes precedence",
+			method:   http.MethodGet,
+			header:   map[string]string{"If-None-Match": `"xyz"`, "If-Modified-Since": modTime.Format(http.TimeFormat)},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not modified since",
+			method:   http.MethodGet,
+			header:   map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "Modified since",
+			method:   http.MethodGet,
+			header:   map[string]string{"If-Modified-Since": modTime.Add(-time.Second).Format(http.TimeFormat)},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Unsafe method",
+			method:   http.MethodPost,
+			header:   map[string]string{"If-None-Match": `"abc"`},
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			if !checkNotModified(rr, r, etag, modTime) {
+				rr.WriteHeader(http.StatusOK)
+			}
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+			assert.Equal(t, rr.Header().Get("ETag"), etag)
+			assert.Equal(t, rr.Header().Get("Last-Modified"), "Fri, 02 Jan 2026 03:04:05 GMT")
+			assert.Equal(t, rr.Header().Get("Cache-Control"), "private, no-cache")
+		})
+	}
+}
+
+func TestSnippetViewConditional(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.snippetModel.Insert(context.Background(), "An old silent pond", "An old silent pond...", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urlPath := fmt.Sprintf("/snippet/view/%d", id)
+
+	getIf := func(t *testing.T, name, value string) (int, http.Header, string) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(name, value)
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readResponse(t, res)
+	}
+
+	// the first page comes with a new CSRF cookie, so it can't be reused
+	code, header, _ := ts.get(t, urlPath)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("ETag"), "")
+	assert.Equal(t, header.Get("Cache-Control"), "no-store")
+
+	code, header, _ = ts.get(t, urlPath)
+	assert.Equal(t, code, http.StatusOK)
+	etag := header.Get("ETag")
+	assert.Equal(t, strings.HasPrefix(etag, `W/"`), true)
+	assert.Equal(t, header.Get("Cache-Control"), "private, no-cache")
+	lastModified := header.Get("Last-Modified")
+	assert.Equal(t, lastModified != "", true)
+
+	// a client without the ETag revalidates with the modification time
+	code, _, body := getIf(t, "If-Modified-Since", lastModified)
+	assert.Equal(t, code, http.StatusNotModified)
+	assert.Equal(t, body, "")
+
+	// the same user gets the same page
+	code, header, body = getIf(t, "If-None-Match", etag)
+	assert.Equal(t, code, http.StatusNotModified)
+	assert.Equal(t, header.Get("ETag"), etag)
+	assert.Equal(t, body, "")
+
+	// the page has other links once the user logs in
+	ts.login(t, ts.Client(), "alice@example.com")
+	code, header, body = getIf(t, "If-None-Match", etag)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("ETag") != etag, true)
+	assert.Equal(t, body != "", true)
+}
@@ -0,0 +1,670 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/obzva/snippetbox/internal/model"
+)
+
+// env variables
+const (
+	configFile         = "SNIPPETBOX_CONFIG"
+	snippetboxPort     = "SNIPPETBOX_PORT"
+	databaseURI        = "DATABASE_URI"
+	migrateOnStartup   = "MIGRATE"
+	purgeInterval      = "PURGE_INTERVAL"
+	tlsCertFile        = "TLS_CERT_FILE"
+	tlsKeyFile         = "TLS_KEY_FILE"
+	tlsMode            = "TLS_MODE"
+	tlsRedirectAddr    = "TLS_REDIRECT_ADDR"
+	tlsReloadInterval  = "TLS_RELOAD_INTERVAL"
+	acmeDomains        = "ACME_DOMAINS"
+	acmeEmail          = "ACME_EMAIL"
+	acmeCacheDir       = "ACME_CACHE_DIR"
+	acmeDirectoryURL   = "ACME_DIRECTORY_URL"
+	readTimeout        = "SERVER_READ_TIMEOUT"
+	writeTimeout       = "SERVER_WRITE_TIMEOUT"
+	idleTimeout        = "SERVER_IDLE_TIMEOUT"
+	shutdownTimeout    = "SERVER_SHUTDOWN_TIMEOUT"
+	drainDelay         = "SERVER_DRAIN_DELAY"
+	sessionLifetime    = "SESSION_LIFETIME"
+	sessionIdleTimeout = "SESSION_IDLE_TIMEOUT"
+	rememberMeLifetime = "REMEMBER_ME_LIFETIME"
+	argon2Memory       = "ARGON2_MEMORY"
+	argon2Iterations   = "ARGON2_ITERATIONS"
+	argon2Parallelism  = "ARGON2_PARALLELISM"
+	breachedPWFile     = "BREACHED_PASSWORDS_FILE"
+	oidcIssuerURL      = "OIDC_ISSUER_URL"
+	oidcClientID       = "OIDC_CLIENT_ID"
+	oidcClientSecret   = "OIDC_CLIENT_SECRET"
+	oidcRedirectURL    = "OIDC_REDIRECT_URL"
+	oidcAutoProvision  = "OIDC_AUTO_PROVISION"
+	rateLimitBackend   = "RATE_LIMIT_BACKEND"
+	trustedProxies     = "TRUSTED_PROXIES"
+	trustedHeader      = "TRUSTED_HEADER"
+	logFormat          = "LOG_FORMAT"
+	logLevel           = "LOG_LEVEL"
+	logAccessSample    = "LOG_ACCESS_SAMPLE_RATIO"
+	adminAddr          = "ADMIN_ADDR"
+	tracingExporter    = "TRACING_EXPORTER"
+	tracingEndpoint    = "TRACING_ENDPOINT"
+	tracingFile        = "TRACING_FILE"
+	tracingSampleRatio = "TRACING_SAMPLE_RATIO"
+)
+
+// replaces secrets in the printed configuration
+const redacted = "xxxxx"
+
+// config is the configuration of the application
+// every setting is taken from, in increasing precedence, its default, the config file, env variables and flags
+type config struct {
+	// address the server listens on, e.g. ":4000"
+	Addr        string `toml:"addr"`
+	DatabaseURI string `toml:"database_uri"`
+	// apply pending database migrations on startup
+	Migrate bool `toml:"migrate"`
+	// path to a file of SHA-1 hashes of breached passwords, no check if empty
+	BreachedPasswordsFile string `toml:"breached_passwords_file"`
+	// interval of deleting expired snippets, zero disables it
+	PurgeInterval time.Duration `toml:"purge_interval"`
+
+	TLS struct {
+		// "file" serves the certificate in cert_file and key_file
+		// "acme" obtains and renews certificates over ACME
+		// "proxy" serves plain HTTP behind a proxy that terminates TLS
+		Mode     string `toml:"mode"`
+		CertFile string `toml:"cert_file"`
+		KeyFile  string `toml:"key_file"`
+		// interval of checking the certificate files for changes in file mode, zero disables it
+		// the certificate is also reloaded on SIGHUP
+		ReloadInterval time.Duration `toml:"reload_interval"`
+		// address of a plain HTTP listener that answers ACME challenges and redirects everything else to HTTPS
+		// disabled if empty
+		RedirectAddr string `toml:"redirect_addr"`
+
+		ACME struct {
+			// domains certificates are obtained for
+			Domains []string `toml:"domains"`
+			// contact address for the ACME account, optional
+			Email string `toml:"email"`
+			// directory the account key and certificates are cached in
+			CacheDir string `toml:"cache_dir"`
+			// Let's Encrypt if empty
+			DirectoryURL string `toml:"directory_url"`
+		} `toml:"acme"`
+	} `toml:"tls"`
+
+	Server struct {
+		ReadTimeout  time.Duration `toml:"read_timeout"`
+		WriteTimeout time.Duration `toml:"write_timeout"`
+		IdleTimeout  time.Duration `toml:"idle_timeout"`
+		// maximum duration for draining in-flight requests and stopping workers on shutdown
+		ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+		// how long requests are still served on shutdown while /readyz reports not-ready
+		DrainDelay time.Duration `toml:"drain_delay"`
+	} `toml:"server"`
+
+	Session struct {
+		Lifetime time.Duration `toml:"lifetime"`
+		// zero disables the idle timeout
+		IdleTimeout        time.Duration `toml:"idle_timeout"`
+		RememberMeLifetime time.Duration `toml:"remember_me_lifetime"`
+	} `toml:"session"`
+
+	Argon2 struct {
+		// KiB
+		Memory      uint32 `toml:"memory"`
+		Iterations  uint32 `toml:"iterations"`
+		Parallelism uint8  `toml:"parallelism"`
+	} `toml:"argon2"`
+
+	// single sign-on is disabled if the issuer URL is empty
+	OIDC struct {
+		IssuerURL     string `toml:"issuer_url"`
+		ClientID      string `toml:"client_id"`
+		ClientSecret  string `toml:"client_secret"`
+		RedirectURL   string `toml:"redirect_url"`
+		AutoProvision bool   `toml:"auto_provision"`
+	} `toml:"oidc"`
+
+	// plain HTTP listener for operators, serving the metrics, profiles, runtime stats and build info
+	Admin struct {
+		// it must be private, on localhost, a loopback address or a unix socket like "unix:/run/snippetbox/admin.sock"
+		// disabled if empty
+		Addr string `toml:"addr"`
+	} `toml:"admin"`
+
+	// CIDRs or IP addresses of the proxies whose forwarding header is believed
+	// e.g. the load balancer, the client IP address is the peer address if empty
+	TrustedProxies []string `toml:"trusted_proxies"`
+	// forwarding header set by the trusted proxies, "forwarded", "x-forwarded-for" or "x-real-ip"
+	// the other ones are ignored, since a client can send them through the proxy
+	TrustedHeader string `toml:"trusted_header"`
+
+	RateLimit struct {
+		// "memory" keeps the buckets of every instance apart, "database" shares them through the database
+		// rate limiting is disabled if empty
+		Backend string `toml:"backend"`
+	} `toml:"rate_limit"`
+
+	Tracing struct {
+		// "otlp", "stdout" or "file", tracing is disabled if empty
+		Exporter string `toml:"exporter"`
+		// OTLP/HTTP traces endpoint, e.g. "http://localhost:4318/v1/traces"
+		// the OTEL_EXPORTER_OTLP_* env variables apply if empty
+		Endpoint string `toml:"endpoint"`
+		// file the spans are appended to by the file exporter
+		File string `toml:"file"`
+		// fraction of new traces that are sampled
+		SampleRatio float64 `toml:"sample_ratio"`
+	} `toml:"tracing"`
+
+	Log struct {
+		// "text" for development or "json" for log aggregators
+		Format string `toml:"format"`
+		// minimum level logged, "debug", "info", "warn" or "error"
+		Level string `toml:"level"`
+		// fraction of the served requests that are logged, server errors are always logged
+		AccessSampleRatio float64 `toml:"access_sample_ratio"`
+	} `toml:"log"`
+}
+
+// options are command-line arguments that aren't part of the configuration
+type options struct {
+	configPath  string
+	printConfig bool
+	// subcommand and its arguments, if any
+	args []string
+}
+
+func defaultConfig() config {
+	var cfg config
+	cfg.Addr = ":4000"
+	cfg.TLS.Mode = tlsModeFile
+	cfg.TLS.CertFile = "./tls/localhost.pem"
+	cfg.TLS.KeyFile = "./tls/localhost-key.pem"
+	cfg.TLS.ReloadInterval = 1 * time.Minute
+	cfg.TLS.ACME.CacheDir = "./tls/acme"
+	cfg.Server.ReadTimeout = 3 * time.Second
+	cfg.Server.WriteTimeout = 10 * time.Second
+	cfg.Server.IdleTimeout = 1 * time.Minute
+	cfg.Server.ShutdownTimeout = 30 * time.Second
+	cfg.PurgeInterval = 1 * time.Hour
+	cfg.Session.Lifetime = 12 * time.Hour
+	cfg.Session.IdleTimeout = 1 * time.Hour
+	cfg.Session.RememberMeLifetime = 30 * 24 * time.Hour
+	cfg.Argon2.Memory = model.DefaultArgon2idParams.Memory
+	cfg.Argon2.Iterations = model.DefaultArgon2idParams.Iterations
+	cfg.Argon2.Parallelism = model.DefaultArgon2idParams.Parallelism
+	cfg.TrustedHeader = trustedHeaderXForwardedFor
+	cfg.RateLimit.Backend = rateLimitBackendMemory
+	cfg.Tracing.SampleRatio = 1
+	cfg.Log.Format = "text"
+	cfg.Log.Level = "info"
+	cfg.Log.AccessSampleRatio = 1
+	return cfg
+}
+
+// load the configuration from the config file, env variables and the command-line args
+// every invalid setting is reported in the returned error
+func loadConfig(args []string, getenv func(string) string, output io.Writer) (config, options, error) {
+	// find the config file first
+	// the flags are parsed again once the config file and env variables are applied
+	cfg := defaultConfig()
+	var opts options
+	fs := newFlagSet(&cfg, &opts)
+	fs.SetOutput(output)
+	if err := fs.Parse(args); err != nil {
+		return config{}, options{}, err
+	}
+	if opts.configPath == "" {
+		opts.configPath = getenv(configFile)
+	}
+
+	cfg = defaultConfig()
+	if opts.configPath != "" {
+		md, err := toml.DecodeFile(opts.configPath, &cfg)
+		if err != nil {
+			return config{}, options{}, fmt.Errorf("config file %s: %w", opts.configPath, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return config{}, options{}, fmt.Errorf("config file %s: unknown keys %s", opts.configPath, strings.Join(keys, ", "))
+		}
+	}
+
+	envErr := cfg.applyEnv(getenv)
+
+	fs = newFlagSet(&cfg, &opts)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return config{}, options{}, err
+	}
+	opts.args = fs.Args()
+	if len(opts.args) > 0 && opts.args[0] != "migrate" {
+		return config{}, options{}, fmt.Errorf("unknown subcommand %q", opts.args[0])
+	}
+
+	if err := errors.Join(envErr, cfg.validate()); err != nil {
+		return config{}, options{}, err
+	}
+	return cfg, opts, nil
+}
+
+// define a flag for each setting, its default is the current value of the setting
+func newFlagSet(cfg *config, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("web", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: web [flags] ["+migrateCommand+"]")
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opts.configPath, "config", opts.configPath, "path to a TOML config file")
+	fs.BoolVar(&opts.printConfig, "print-config", opts.printConfig, "print the configuration with secrets redacted and exit")
+
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "address the server listens on")
+	fs.StringVar(&cfg.DatabaseURI, "database-uri", cfg.DatabaseURI, "URI of the database")
+	fs.BoolVar(&cfg.Migrate, "migrate", cfg.Migrate, "apply pending database migrations on startup")
+	fs.StringVar(&cfg.BreachedPasswordsFile, "breached-passwords-file", cfg.BreachedPasswordsFile, "path to a file of SHA-1 hashes of breached passwords")
+	fs.DurationVar(&cfg.PurgeInterval, "purge-interval", cfg.PurgeInterval, "interval of deleting expired snippets, 0 disables it")
+	fs.StringVar(&cfg.TLS.Mode, "tls-mode", cfg.TLS.Mode, `TLS mode, "file", "acme" or "proxy"`)
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert-file", cfg.TLS.CertFile, "path to the TLS certificate")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key-file", cfg.TLS.KeyFile, "path to the TLS private key")
+	fs.DurationVar(&cfg.TLS.ReloadInterval, "tls-reload-interval", cfg.TLS.ReloadInterval, "interval of checking the TLS certificate files for changes, 0 disables it")
+	fs.StringVar(&cfg.TLS.RedirectAddr, "tls-redirect-addr", cfg.TLS.RedirectAddr, "address of a plain HTTP listener redirecting to HTTPS and answering ACME challenges")
+	fs.Var(listValue{&cfg.TLS.ACME.Domains}, "acme-domains", "comma-separated domains to obtain certificates for")
+	fs.StringVar(&cfg.TLS.ACME.Email, "acme-email", cfg.TLS.ACME.Email, "contact address for the ACME account")
+	fs.StringVar(&cfg.TLS.ACME.CacheDir, "acme-cache-dir", cfg.TLS.ACME.CacheDir, "directory to cache ACME certificates in")
+	fs.StringVar(&cfg.TLS.ACME.DirectoryURL, "acme-directory-url", cfg.TLS.ACME.DirectoryURL, "directory URL of the ACME server, Let's Encrypt if empty")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "maximum duration for reading a request")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "maximum duration for writing a response")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "maximum duration a keep-alive connection waits for the next request")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "maximum duration for draining requests on shutdown")
+	fs.DurationVar(&cfg.Server.DrainDelay, "drain-delay", cfg.Server.DrainDelay, "how long requests are still served on shutdown while /readyz reports not-ready")
+	fs.DurationVar(&cfg.Session.Lifetime, "session-lifetime", cfg.Session.Lifetime, "lifetime of a session")
+	fs.DurationVar(&cfg.Session.IdleTimeout, "session-idle-timeout", cfg.Session.IdleTimeout, "inactivity after which a session is logged out, 0 disables it")
+	fs.DurationVar(&cfg.Session.RememberMeLifetime, "remember-me-lifetime", cfg.Session.RememberMeLifetime, "lifetime of a remembered session")
+	fs.Var(uintValue[uint32]{&cfg.Argon2.Memory}, "argon2-memory", "memory of argon2id password hashing in KiB")
+	fs.Var(uintValue[uint32]{&cfg.Argon2.Iterations}, "argon2-iterations", "iterations of argon2id password hashing")
+	fs.Var(uintValue[uint8]{&cfg.Argon2.Parallelism}, "argon2-parallelism", "parallelism of argon2id password hashing")
+	fs.StringVar(&cfg.OIDC.IssuerURL, "oidc-issuer-url", cfg.OIDC.IssuerURL, "issuer URL of the single sign-on identity provider")
+	fs.StringVar(&cfg.OIDC.ClientID, "oidc-client-id", cfg.OIDC.ClientID, "client ID registered at the identity provider")
+	fs.StringVar(&cfg.OIDC.ClientSecret, "oidc-client-secret", cfg.OIDC.ClientSecret, "client secret registered at the identity provider")
+	fs.StringVar(&cfg.OIDC.RedirectURL, "oidc-redirect-url", cfg.OIDC.RedirectURL, "URL the identity provider redirects to after login")
+	fs.BoolVar(&cfg.OIDC.AutoProvision, "oidc-auto-provision", cfg.OIDC.AutoProvision, "create an account on the first single sign-on login")
+	fs.StringVar(&cfg.Admin.Addr, "admin-addr", cfg.Admin.Addr, `loopback address of the admin listener, or "unix:" and a socket path, disabled if empty`)
+	fs.Var(listValue{&cfg.TrustedProxies}, "trusted-proxies", "comma-separated CIDRs or IP addresses of the proxies whose forwarding header is believed")
+	fs.StringVar(&cfg.TrustedHeader, "trusted-header", cfg.TrustedHeader, `forwarding header set by the trusted proxies, "forwarded", "x-forwarded-for" or "x-real-ip"`)
+	fs.StringVar(&cfg.RateLimit.Backend, "rate-limit-backend", cfg.RateLimit.Backend, `rate limiter backend, "memory" or "database", disabled if empty`)
+	fs.StringVar(&cfg.Tracing.Exporter, "tracing-exporter", cfg.Tracing.Exporter, `tracing exporter, "otlp", "stdout" or "file", disabled if empty`)
+	fs.StringVar(&cfg.Tracing.Endpoint, "tracing-endpoint", cfg.Tracing.Endpoint, "OTLP/HTTP traces endpoint")
+	fs.StringVar(&cfg.Tracing.File, "tracing-file", cfg.Tracing.File, "file the file exporter appends spans to")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "tracing-sample-ratio", cfg.Tracing.SampleRatio, "fraction of new traces that are sampled")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, `log format, "text" or "json"`)
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, `minimum log level, "debug", "info", "warn" or "error"`)
+	fs.Float64Var(&cfg.Log.AccessSampleRatio, "log-access-sample-ratio", cfg.Log.AccessSampleRatio, "fraction of the served requests that are logged")
+
+	return fs
+}
+
+// override the settings whose env variables are set
+func (cfg *config) applyEnv(getenv func(string) string) error {
+	var errs []error
+
+	str := func(name string, p *string) {
+		if v := getenv(name); v != "" {
+			*p = v
+		}
+	}
+	duration := func(name string, p *time.Duration) {
+		if v := getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*p = d
+		}
+	}
+	boolean := func(name string, p *bool) {
+		if v := getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*p = b
+		}
+	}
+	float := func(name string, p *float64) {
+		if v := getenv(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*p = f
+		}
+	}
+	unsigned := func(name string, v flag.Value) {
+		if s := getenv(name); s != "" {
+			if err := v.Set(s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+
+	str(snippetboxPort, &cfg.Addr)
+	str(databaseURI, &cfg.DatabaseURI)
+	boolean(migrateOnStartup, &cfg.Migrate)
+	str(breachedPWFile, &cfg.BreachedPasswordsFile)
+	duration(purgeInterval, &cfg.PurgeInterval)
+	str(tlsCertFile, &cfg.TLS.CertFile)
+	str(tlsKeyFile, &cfg.TLS.KeyFile)
+	str(tlsMode, &cfg.TLS.Mode)
+	str(tlsRedirectAddr, &cfg.TLS.RedirectAddr)
+	duration(tlsReloadInterval, &cfg.TLS.ReloadInterval)
+	if v := getenv(acmeDomains); v != "" {
+		listValue{&cfg.TLS.ACME.Domains}.Set(v)
+	}
+	str(acmeEmail, &cfg.TLS.ACME.Email)
+	str(acmeCacheDir, &cfg.TLS.ACME.CacheDir)
+	str(acmeDirectoryURL, &cfg.TLS.ACME.DirectoryURL)
+	duration(readTimeout, &cfg.Server.ReadTimeout)
+	duration(writeTimeout, &cfg.Server.WriteTimeout)
+	duration(idleTimeout, &cfg.Server.IdleTimeout)
+	duration(shutdownTimeout, &cfg.Server.ShutdownTimeout)
+	duration(drainDelay, &cfg.Server.DrainDelay)
+	duration(sessionLifetime, &cfg.Session.Lifetime)
+	duration(sessionIdleTimeout, &cfg.Session.IdleTimeout)
+	duration(rememberMeLifetime, &cfg.Session.RememberMeLifetime)
+	unsigned(argon2Memory, uintValue[uint32]{&cfg.Argon2.Memory})
+	unsigned(argon2Iterations, uintValue[uint32]{&cfg.Argon2.Iterations})
+	unsigned(argon2Parallelism, uintValue[uint8]{&cfg.Argon2.Parallelism})
+	str(oidcIssuerURL, &cfg.OIDC.IssuerURL)
+	str(oidcClientID, &cfg.OIDC.ClientID)
+	str(oidcClientSecret, &cfg.OIDC.ClientSecret)
+	str(oidcRedirectURL, &cfg.OIDC.RedirectURL)
+	boolean(oidcAutoProvision, &cfg.OIDC.AutoProvision)
+	str(logFormat, &cfg.Log.Format)
+	str(logLevel, &cfg.Log.Level)
+	float(logAccessSample, &cfg.Log.AccessSampleRatio)
+	str(adminAddr, &cfg.Admin.Addr)
+	if v := getenv(trustedProxies); v != "" {
+		listValue{&cfg.TrustedProxies}.Set(v)
+	}
+	str(trustedHeader, &cfg.TrustedHeader)
+	str(rateLimitBackend, &cfg.RateLimit.Backend)
+	str(tracingExporter, &cfg.Tracing.Exporter)
+	str(tracingEndpoint, &cfg.Tracing.Endpoint)
+	str(tracingFile, &cfg.Tracing.File)
+	float(tracingSampleRatio, &cfg.Tracing.SampleRatio)
+
+	return errors.Join(errs...)
+}
+
+// check every setting and report all the invalid ones at once
+func (cfg *config) validate() error {
+	var errs []error
+
+	if cfg.Addr == "" {
+		errs = append(errs, errors.New("addr: must be set"))
+	}
+	if cfg.DatabaseURI == "" {
+		errs = append(errs, errors.New("database_uri: must be set"))
+	} else if _, err := url.Parse(cfg.DatabaseURI); err != nil {
+		errs = append(errs, errors.New("database_uri: invalid URI"))
+	}
+	if cfg.PurgeInterval < 0 {
+		errs = append(errs, errors.New("purge_interval: must not be negative"))
+	}
+	switch cfg.TLS.Mode {
+	case tlsModeFile:
+		if cfg.TLS.CertFile == "" {
+			errs = append(errs, errors.New("tls.cert_file: must be set in file mode"))
+		}
+		if cfg.TLS.KeyFile == "" {
+			errs = append(errs, errors.New("tls.key_file: must be set in file mode"))
+		}
+		if cfg.TLS.ReloadInterval < 0 {
+			errs = append(errs, errors.New("tls.reload_interval: must not be negative"))
+		}
+	case tlsModeACME:
+		if len(cfg.TLS.ACME.Domains) == 0 {
+			errs = append(errs, errors.New("tls.acme.domains: must be set in acme mode"))
+		}
+		if cfg.TLS.ACME.CacheDir == "" {
+			errs = append(errs, errors.New("tls.acme.cache_dir: must be set in acme mode"))
+		}
+		if cfg.TLS.RedirectAddr == "" {
+			errs = append(errs, errors.New("tls.redirect_addr: must be set in acme mode"))
+		}
+	case tlsModeProxy:
+		if cfg.TLS.RedirectAddr != "" {
+			errs = append(errs, errors.New("tls.redirect_addr: must not be set in proxy mode"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(`tls.mode: must be "file", "acme" or "proxy", got %q`, cfg.TLS.Mode))
+	}
+	if cfg.Server.ReadTimeout <= 0 {
+		errs = append(errs, errors.New("server.read_timeout: must be positive"))
+	}
+	if cfg.Server.WriteTimeout <= 0 {
+		errs = append(errs, errors.New("server.write_timeout: must be positive"))
+	}
+	if cfg.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("server.idle_timeout: must be positive"))
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout: must be positive"))
+	}
+	if cfg.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("server.drain_delay: must not be negative"))
+	}
+	if cfg.Session.Lifetime <= 0 {
+		errs = append(errs, errors.New("session.lifetime: must be positive"))
+	}
+	if cfg.Session.IdleTimeout < 0 {
+		errs = append(errs, errors.New("session.idle_timeout: must not be negative"))
+	}
+	if cfg.Session.RememberMeLifetime <= 0 {
+		errs = append(errs, errors.New("session.remember_me_lifetime: must be positive"))
+	}
+	if cfg.Argon2.Iterations == 0 {
+		errs = append(errs, errors.New("argon2.iterations: must be positive"))
+	}
+	if cfg.Argon2.Parallelism == 0 {
+		errs = append(errs, errors.New("argon2.parallelism: must be positive"))
+	}
+	// argon2 needs at least 8 KiB per lane
+	if cfg.Argon2.Memory < 8*uint32(cfg.Argon2.Parallelism) {
+		errs = append(errs, errors.New("argon2.memory: must be at least 8 KiB per parallelism"))
+	}
+	if cfg.OIDC.IssuerURL != "" {
+		if cfg.OIDC.ClientID == "" {
+			errs = append(errs, errors.New("oidc.client_id: must be set with oidc.issuer_url"))
+		}
+		if cfg.OIDC.RedirectURL == "" {
+			errs = append(errs, errors.New("oidc.redirect_url: must be set with oidc.issuer_url"))
+		}
+	}
+	if cfg.Admin.Addr != "" && cfg.Admin.Addr == cfg.Addr {
+		errs = append(errs, errors.New("admin.addr: must differ from addr"))
+	}
+	if cfg.Admin.Addr == "unix:" {
+		errs = append(errs, errors.New("admin.addr: the unix socket path must be set"))
+	} else if cfg.Admin.Addr != "" && !strings.HasPrefix(cfg.Admin.Addr, "unix:") {
+		if err := checkLoopbackAddr(cfg.Admin.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("admin.addr: %w", err))
+		}
+	}
+	if _, err := cfg.trustedProxyPrefixes(); err != nil {
+		errs = append(errs, fmt.Errorf("trusted_proxies: %w", err))
+	}
+	switch cfg.TrustedHeader {
+	case trustedHeaderForwarded, trustedHeaderXForwardedFor, trustedHeaderXRealIP:
+	default:
+		errs = append(errs, fmt.Errorf(`trusted_header: must be "forwarded", "x-forwarded-for" or "x-real-ip", got %q`, cfg.TrustedHeader))
+	}
+	switch cfg.RateLimit.Backend {
+	case "", rateLimitBackendMemory, rateLimitBackendDatabase:
+	default:
+		errs = append(errs, fmt.Errorf(`rate_limit.backend: must be "memory" or "database", got %q`, cfg.RateLimit.Backend))
+	}
+	switch cfg.Tracing.Exporter {
+	case "", tracingExporterOTLP, tracingExporterStdout:
+	case tracingExporterFile:
+		if cfg.Tracing.File == "" {
+			errs = append(errs, errors.New("tracing.file: must be set with the file exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(`tracing.exporter: must be "otlp", "stdout" or "file", got %q`, cfg.Tracing.Exporter))
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio: must be between 0 and 1"))
+	}
+	if cfg.Log.Format != "text" && cfg.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf(`log.format: must be "text" or "json", got %q`, cfg.Log.Format))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf(`log.level: must be "debug", "info", "warn" or "error", got %q`, cfg.Log.Level))
+	}
+	if cfg.Log.AccessSampleRatio < 0 || cfg.Log.AccessSampleRatio > 1 {
+		errs = append(errs, errors.New("log.access_sample_ratio: must be between 0 and 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// return the argon2id parameters for hashing new passwords
+func (cfg *config) argon2idParams() model.Argon2idParams {
+	p := model.DefaultArgon2idParams
+	p.Memory = cfg.Argon2.Memory
+	p.Iterations = cfg.Argon2.Iterations
+	p.Parallelism = cfg.Argon2.Parallelism
+	return p
+}
+
+// parse the trusted proxies, an IP address is a prefix of its own
+func (cfg *config) trustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, s := range cfg.TrustedProxies {
+		if ip, err := netip.ParseAddr(s); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// return the minimum level logged
+func (cfg *config) logLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Log.Level))
+	return level
+}
+
+// write the configuration as TOML with its secrets redacted
+func (cfg config) print(w io.Writer) error {
+	cfg.DatabaseURI = redactURI(cfg.DatabaseURI)
+	if cfg.OIDC.ClientSecret != "" {
+		cfg.OIDC.ClientSecret = redacted
+	}
+	return toml.NewEncoder(w).Encode(cfg)
+}
+
+// password parameters of a PostgreSQL connection string in the keyword/value form, e.g. "host=db password='pa ss'"
+// the value is either single-quoted, with backslash escapes, or runs until the next space
+var dsnPasswordRX = regexp.MustCompile(`(?i)\b(\w*password\s*=\s*)('(?:\\.|[^'\\])*'|\S*)`)
+
+// replace the passwords in the database URI, if any
+// it may also be a PostgreSQL connection string in the keyword/value form
+func redactURI(uri string) string {
+	if !strings.Contains(uri, "://") {
+		return dsnPasswordRX.ReplaceAllString(uri, "${1}"+redacted)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	// libpq also takes the password as a query parameter
+	q := u.Query()
+	for k := range q {
+		if strings.HasSuffix(strings.ToLower(k), "password") {
+			q.Set(k, redacted)
+			u.RawQuery = q.Encode()
+		}
+	}
+	return u.String()
+}
+
+// listValue is a flag.Value of comma-separated strings
+type listValue struct {
+	p *[]string
+}
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v listValue) Set(s string) error {
+	var list []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*v.p = list
+	return nil
+}
+
+// uintValue is a flag.Value of an unsigned integer type
+type uintValue[T uint8 | uint32] struct {
+	p *T
+}
+
+func (v uintValue[T]) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.FormatUint(uint64(*v.p), 10)
+}
+
+func (v uintValue[T]) Set(s string) error {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	if uint64(T(n)) != n {
+		return fmt.Errorf("%s is out of range", s)
+	}
+	*v.p = T(n)
+	return nil
+}
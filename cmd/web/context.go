@@ -2,4 +2,9 @@ package main
 
 type contextKey string
 
-const ctxKeyAuth = contextKey("authenticated")
+const (
+	ctxKeyAuth         = contextKey("authenticated")
+	ctxKeyRoutePattern = contextKey("routePattern")
+	ctxKeyRequestID    = contextKey("requestID")
+	ctxKeyClientIP     = contextKey("clientIP")
+)
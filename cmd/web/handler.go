@@ -6,8 +6,10 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/obzva/snippetbox/internal/model"
+	"github.com/obzva/snippetbox/internal/sso"
 	"github.com/obzva/snippetbox/internal/validator"
 )
 
@@ -20,6 +22,30 @@ func ping(app *application) func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// report that the process is alive, whatever the state of its dependencies
+func getHealthz(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := writeJSON(w, http.StatusOK, map[string]string{"status": "ok"}); err != nil {
+			app.logger.ErrorContext(r.Context(), err.Error())
+		}
+	}
+}
+
+// report whether the dependencies are available and the server isn't shutting down
+func getReadyz(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, ok := app.health.ready(r.Context(), app.logger)
+
+		statusCode := http.StatusOK
+		if !ok {
+			statusCode = http.StatusServiceUnavailable
+		}
+		if err := writeJSON(w, statusCode, report); err != nil {
+			app.logger.ErrorContext(r.Context(), err.Error())
+		}
+	}
+}
+
 func getHome(app *application) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		snippets, err := app.snippetModel.Latest(r.Context())
@@ -62,6 +88,18 @@ func getSnippetView(app *application) func(w http.ResponseWriter, r *http.Reques
 		td := newTemplateData(app, r)
 		td.Snippet = s
 
+		// snippets don't change until they expire, so the page is the same until the user state changes
+		// nor before the templates and static files it is rendered with were loaded
+		modTime := s.Created
+		if app.assets.loaded.After(modTime) {
+			modTime = app.assets.loaded
+		}
+		if etag, ok := pageETag(app, r, td, s); !ok {
+			w.Header().Set("Cache-Control", "no-store")
+		} else if checkNotModified(w, r, etag, modTime) {
+			return
+		}
+
 		app.render(w, r, http.StatusOK, "view.tmpl", td)
 	}
 }
@@ -128,6 +166,7 @@ func postSnippetCreate(app *application) func(w http.ResponseWriter, r *http.Req
 			app.serverError(w, r, err.Error())
 			return
 		}
+		app.metrics.snippetsCreated.Inc()
 
 		app.sessionManager.Put(r.Context(), sessionKeyFlash, "Snippet was successfully created!")
 
@@ -148,9 +187,10 @@ func getUserSignup(app *application) func(w http.ResponseWriter, r *http.Request
 }
 
 const (
-	fieldName     = "name"
-	fieldEmail    = "email"
-	fieldPassword = "password"
+	fieldName       = "name"
+	fieldEmail      = "email"
+	fieldPassword   = "password"
+	fieldRememberMe = "remember"
 )
 
 func postUserSignup(app *application) func(w http.ResponseWriter, r *http.Request) {
@@ -173,6 +213,14 @@ func postUserSignup(app *application) func(w http.ResponseWriter, r *http.Reques
 		v.CheckField(validator.StringMatch(form.Email, validator.EmailRegexp), fieldEmail, "this field must be a valid email address")
 		v.CheckField(validator.StringNotBlank(form.Password), fieldPassword, "this field cannot be blank")
 		v.CheckField(validator.RunesMin(form.Password, 8), fieldPassword, "this field must be at least 8 runes long")
+		notBreached, err := validator.PasswordNotBreached(form.Password, app.breachedPasswords)
+		if err != nil {
+			app.serverError(w, r, err.Error())
+			return
+		}
+		v.CheckField(notBreached, fieldPassword, "this password has appeared in a data breach, please choose another one")
+		v.CheckField(validator.PasswordNotPersonal(form.Password, form.Name, form.Email), fieldPassword, "this field cannot contain your name or email address")
+		v.CheckField(validator.PasswordStrong(form.Password), fieldPassword, "this password is too easy to guess, try a longer one or mix in numbers and symbols")
 
 		if !v.CheckValidity() {
 			td := newTemplateData(app, r)
@@ -195,6 +243,7 @@ func postUserSignup(app *application) func(w http.ResponseWriter, r *http.Reques
 			}
 			return
 		}
+		app.metrics.signups.Inc()
 
 		app.sessionManager.Put(r.Context(), sessionKeyFlash, "Your signup was successful. Please log in.")
 
@@ -204,6 +253,7 @@ func postUserSignup(app *application) func(w http.ResponseWriter, r *http.Reques
 
 type userLoginForm struct {
 	Email, Password string
+	RememberMe      bool
 }
 
 func getUserLogin(app *application) func(w http.ResponseWriter, r *http.Request) {
@@ -225,8 +275,9 @@ func postUserLogin(app *application) func(w http.ResponseWriter, r *http.Request
 
 		v := validator.NewValidator()
 		form := userLoginForm{
-			Email:    r.PostForm.Get(fieldEmail),
-			Password: r.PostForm.Get(fieldPassword),
+			Email:      r.PostForm.Get(fieldEmail),
+			Password:   r.PostForm.Get(fieldPassword),
+			RememberMe: r.PostForm.Get(fieldRememberMe) == "true",
 		}
 
 		v.CheckField(validator.StringNotBlank(form.Email), fieldEmail, "this field cannot be blank")
@@ -246,6 +297,7 @@ func postUserLogin(app *application) func(w http.ResponseWriter, r *http.Request
 		id, err := app.userModel.Authenticate(r.Context(), form.Email, form.Password)
 		if err != nil {
 			if errors.Is(err, model.ErrInvalidCredentials) {
+				app.metrics.failedLogins.Inc()
 				v.AddNonFieldError("Email or password is incorrect")
 
 				td := newTemplateData(app, r)
@@ -260,13 +312,91 @@ func postUserLogin(app *application) func(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		err = app.sessionManager.RenewToken(r.Context())
+		err = app.startUserSession(r, id, form.RememberMe)
 		if err != nil {
 			app.serverError(w, r, err.Error())
 			return
 		}
 
-		app.sessionManager.Put(r.Context(), sessionKeyAuth, id)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+func getUserLoginSSO(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f := sso.NewFlow()
+
+		app.sessionManager.Put(r.Context(), sessionKeySSOState, f.State)
+		app.sessionManager.Put(r.Context(), sessionKeySSONonce, f.Nonce)
+		app.sessionManager.Put(r.Context(), sessionKeySSOVerifier, f.Verifier)
+
+		http.Redirect(w, r, app.ssoProvider.AuthCodeURL(f), http.StatusSeeOther)
+	}
+}
+
+func getUserLoginSSOCallback(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the flow can be completed only once
+		f := sso.Flow{
+			State:    app.sessionManager.PopString(r.Context(), sessionKeySSOState),
+			Nonce:    app.sessionManager.PopString(r.Context(), sessionKeySSONonce),
+			Verifier: app.sessionManager.PopString(r.Context(), sessionKeySSOVerifier),
+		}
+
+		q := r.URL.Query()
+		if !f.CheckState(q.Get("state")) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		// e.g. the user denied the request at the identity provider
+		if q.Get("error") != "" {
+			app.sessionManager.Put(r.Context(), sessionKeyFlash, "Single sign-on was cancelled.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		identity, err := app.ssoProvider.Exchange(r.Context(), q.Get("code"), f)
+		if err != nil {
+			if errors.Is(err, sso.ErrEmailNotVerified) {
+				app.sessionManager.Put(r.Context(), sessionKeyFlash, "Your email address is not verified by the identity provider.")
+				http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			} else if errors.Is(err, sso.ErrNonceMismatch) {
+				// e.g. an ID token replayed from another flow
+				app.clientError(w, http.StatusBadRequest)
+			} else {
+				app.serverError(w, r, err.Error())
+			}
+			return
+		}
+
+		// link to the user with the verified email or provision a new one
+		id, err := app.userModel.IDByEmail(r.Context(), identity.Email)
+		if errors.Is(err, model.ErrNoRecord) && app.ssoAutoProvision {
+			name := identity.Name
+			if name == "" {
+				name, _, _ = strings.Cut(identity.Email, "@")
+			}
+			id, err = app.userModel.InsertWithoutPassword(r.Context(), name, identity.Email)
+			if err == nil {
+				app.metrics.signups.Inc()
+			}
+		}
+		if err != nil {
+			if errors.Is(err, model.ErrNoRecord) {
+				app.sessionManager.Put(r.Context(), sessionKeyFlash, "There is no account with your email address. Please sign up first.")
+				http.Redirect(w, r, "/user/signup", http.StatusSeeOther)
+			} else {
+				app.serverError(w, r, err.Error())
+			}
+			return
+		}
+
+		err = app.startUserSession(r, id, false)
+		if err != nil {
+			app.serverError(w, r, err.Error())
+			return
+		}
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
@@ -274,16 +404,81 @@ func postUserLogin(app *application) func(w http.ResponseWriter, r *http.Request
 
 func postUserLogout(app *application) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := app.sessionManager.RenewToken(r.Context())
+		err := app.endUserSession(r)
 		if err != nil {
 			app.serverError(w, r, err.Error())
 			return
 		}
 
-		app.sessionManager.Remove(r.Context(), sessionKeyAuth)
-
 		app.sessionManager.Put(r.Context(), sessionKeyFlash, "You've been logged out successfully!")
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
+
+func getAccountSessions(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := app.sessionManager.GetInt(r.Context(), sessionKeyAuth)
+
+		userSessions, err := app.userSessionModel.List(r.Context(), userID)
+		if err != nil {
+			app.serverError(w, r, err.Error())
+			return
+		}
+
+		td := newTemplateData(app, r)
+		td.UserSessions = userSessions
+		td.CurrentSessionID = app.sessionManager.GetString(r.Context(), sessionKeySessionID)
+
+		app.render(w, r, http.StatusOK, "sessions.tmpl", td)
+	}
+}
+
+func postAccountSessionRevoke(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		// revoking the current session is the same as logging out
+		if id == app.sessionManager.GetString(r.Context(), sessionKeySessionID) {
+			err := app.endUserSession(r)
+			if err != nil {
+				app.serverError(w, r, err.Error())
+				return
+			}
+
+			app.sessionManager.Put(r.Context(), sessionKeyFlash, "You've been logged out successfully!")
+
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		userID := app.sessionManager.GetInt(r.Context(), sessionKeyAuth)
+
+		err := app.userSessionModel.Revoke(r.Context(), id, userID)
+		if err != nil {
+			app.serverError(w, r, err.Error())
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), sessionKeyFlash, "The session was signed out.")
+
+		http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+	}
+}
+
+func postAccountSessionsRevokeOthers(app *application) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := app.sessionManager.GetInt(r.Context(), sessionKeyAuth)
+		sessionID := app.sessionManager.GetString(r.Context(), sessionKeySessionID)
+
+		err := app.userSessionModel.RevokeOthers(r.Context(), sessionID, userID)
+		if err != nil {
+			app.serverError(w, r, err.Error())
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), sessionKeyFlash, "All other sessions were signed out.")
+
+		http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+	}
+}
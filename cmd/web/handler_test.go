@@ -2,20 +2,26 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alexedwards/scs/v2"
 	"github.com/obzva/snippetbox/internal/assert"
+	"github.com/obzva/snippetbox/internal/sso"
+	"github.com/obzva/snippetbox/internal/sso/ssotest"
 )
 
 func TestPing(t *testing.T) {
-	app := &application{
-		logger: slog.New(slog.DiscardHandler),
-	}
-	ts := httptest.NewTLSServer(routes(app))
+	app := newTestApplication(t)
+	ts := httptest.NewTLSServer(handler(app))
 	defer ts.Close()
 
 	res, err := ts.Client().Get(ts.URL + "/ping")
@@ -35,3 +41,554 @@ func TestPing(t *testing.T) {
 	// test response body
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestSnippetView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	id, err := app.snippetModel.Insert(context.Background(), "An old silent pond", "An old silent pond...", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  fmt.Sprintf("/snippet/view/%d", id),
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond...",
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  fmt.Sprintf("/snippet/view/%d", id+1),
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+}
+
+func TestUserSignup(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, body := ts.get(t, "/user/signup")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		userName     string
+		userEmail    string
+		userPassword string
+		csrfToken    string
+		wantCode     int
+		wantBody     string
+	}{
+		{
+			name:         "Valid submission",
+			userName:     "Bob",
+			userEmail:    "bob@example.com",
+			userPassword: testPassword,
+			csrfToken:    csrfToken,
+			wantCode:     http.StatusSeeOther,
+		},
+		{
+			name:         "Invalid CSRF token",
+			userName:     "Bob",
+			userEmail:    "bob@example.com",
+			userPassword: testPassword,
+			csrfToken:    "wrongToken",
+			wantCode:     http.StatusBadRequest,
+		},
+		{
+			name:         "Empty name",
+			userName:     "",
+			userEmail:    "bob@example.com",
+			userPassword: testPassword,
+			csrfToken:    csrfToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "this field cannot be blank",
+		},
+		{
+			name:         "Invalid email",
+			userName:     "Bob",
+			userEmail:    "bob@example.",
+			userPassword: testPassword,
+			csrfToken:    csrfToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "this field must be a valid email address",
+		},
+		{
+			name:         "Short password",
+			userName:     "Bob",
+			userEmail:    "bob@example.com",
+			userPassword: "pa$$",
+			csrfToken:    csrfToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "this field must be at least 8 runes long",
+		},
+		{
+			name:         "Weak password",
+			userName:     "Bob",
+			userEmail:    "bob@example.com",
+			userPassword: "aaaaaaaaaa",
+			csrfToken:    csrfToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "this password is too easy to guess",
+		},
+		{
+			name:         "Duplicate email",
+			userName:     "Alice",
+			userEmail:    "alice@example.com",
+			userPassword: testPassword,
+			csrfToken:    csrfToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantBody:     "email address is already in use",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{
+				fieldName:     {tt.userName},
+				fieldEmail:    {tt.userEmail},
+				fieldPassword: {tt.userPassword},
+				"csrf_token":  {tt.csrfToken},
+			}
+
+			code, _, body := ts.postForm(t, "/user/signup", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, strings.Contains(body, tt.wantBody), true)
+		})
+	}
+}
+
+func TestUserLoginLogout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Wrong password", func(t *testing.T) {
+		_, _, body := ts.get(t, "/user/login")
+		form := url.Values{
+			fieldEmail:    {"alice@example.com"},
+			fieldPassword: {"wrong password"},
+			"csrf_token":  {extractCSRFToken(t, body)},
+		}
+
+		code, _, body := ts.postForm(t, "/user/login", form)
+
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.Equal(t, strings.Contains(body, "Email or password is incorrect"), true)
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		ts.login(t, ts.Client(), "alice@example.com")
+
+		code, _, body := ts.get(t, "/")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "Logout"), true)
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		_, _, body := ts.get(t, "/")
+		form := url.Values{
+			"csrf_token": {extractCSRFToken(t, body)},
+		}
+
+		code, header, _ := ts.postForm(t, "/user/logout", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/")
+
+		code, header, _ = ts.get(t, "/snippet/create")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+}
+
+// expiryStore records the expiry of the sessions it commits
+type expiryStore struct {
+	scs.Store
+	mu     sync.Mutex
+	expiry map[string]time.Time
+}
+
+func (es *expiryStore) Commit(token string, b []byte, expiry time.Time) error {
+	es.mu.Lock()
+	es.expiry[token] = expiry
+	es.mu.Unlock()
+	return es.Store.Commit(token, b, expiry)
+}
+
+// return the expiry of the session the client has
+func (es *expiryStore) clientExpiry(t *testing.T, ts *testServer, client *http.Client) time.Time {
+	t.Helper()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == "session" {
+			es.mu.Lock()
+			defer es.mu.Unlock()
+			return es.expiry[c.Value]
+		}
+	}
+	t.Fatal("no session cookie")
+	return time.Time{}
+}
+
+func TestRememberMe(t *testing.T) {
+	app := newTestApplication(t)
+	store := &expiryStore{Store: app.sessionManager.Store, expiry: make(map[string]time.Time)}
+	app.sessionManager.Store = store
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		rememberMe  bool
+		wantPersist bool
+		wantExpiry  time.Duration
+	}{
+		{
+			name:        "Browser session",
+			rememberMe:  false,
+			wantPersist: false,
+			wantExpiry:  app.sessionManager.Lifetime,
+		},
+		{
+			name:        "Remember me",
+			rememberMe:  true,
+			wantPersist: true,
+			wantExpiry:  app.rememberMeLifetime,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := ts.newClient(t)
+			header := ts.loginRememberMe(t, client, "alice@example.com", tt.rememberMe)
+
+			res := http.Response{Header: header}
+			var cookie *http.Cookie
+			for _, c := range res.Cookies() {
+				if c.Name == "session" {
+					cookie = c
+				}
+			}
+			if cookie == nil {
+				t.Fatal("no session cookie")
+			}
+			assert.Equal(t, !cookie.Expires.IsZero(), tt.wantPersist)
+
+			expiry := store.clientExpiry(t, ts, client)
+			assert.Equal(t, time.Until(expiry).Round(time.Minute), tt.wantExpiry)
+
+			// the signed-in session lasts as long as the session
+			sessions, err := app.userSessionModel.List(context.Background(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, sessions[0].Expires.Sub(expiry).Abs() < time.Second, true)
+
+			// after logging out, the session is a browser session with the default lifetime again
+			_, _, body := ts.getWith(t, client, "/")
+			form := url.Values{
+				"csrf_token": {extractCSRFToken(t, body)},
+			}
+			code, header, _ := ts.postFormWith(t, client, "/user/logout", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			res = http.Response{Header: header}
+			for _, c := range res.Cookies() {
+				if c.Name == "session" {
+					assert.Equal(t, c.Expires.IsZero(), true)
+				}
+			}
+			expiry = store.clientExpiry(t, ts, client)
+			assert.Equal(t, time.Until(expiry).Round(time.Minute), app.sessionManager.Lifetime)
+		})
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		rememberMe bool
+		wantCode   int
+	}{
+		{
+			name:       "Browser session",
+			rememberMe: false,
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Remember me",
+			rememberMe: true,
+			wantCode:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.sessionIdleTimeout = 100 * time.Millisecond
+			ts := newTestServer(t, handler(app))
+
+			err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.loginRememberMe(t, ts.Client(), "alice@example.com", tt.rememberMe)
+
+			code, _, _ := ts.get(t, "/snippet/create")
+			assert.Equal(t, code, http.StatusOK)
+
+			time.Sleep(2 * app.sessionIdleTimeout)
+
+			code, _, _ = ts.get(t, "/snippet/create")
+			assert.Equal(t, code, tt.wantCode)
+
+			// the signed-in session is gone with the sign-out
+			sessions, err := app.userSessionModel.List(context.Background(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, len(sessions) == 1, tt.rememberMe)
+		})
+	}
+}
+
+func TestUserLoginSSO(t *testing.T) {
+	const aliceEmail = "alice@example.com"
+	verified := map[string]any{"email": aliceEmail, "email_verified": true, "name": "Alice"}
+
+	tests := []struct {
+		name          string
+		claims        map[string]any
+		existingUser  bool
+		autoProvision bool
+		// state sent back to the callback instead of the one of the flow if not empty
+		state        string
+		wantCode     int
+		wantLocation string
+		// whether alice has an account afterwards
+		wantUser bool
+	}{
+		{
+			name:         "Link existing account",
+			claims:       verified,
+			existingUser: true,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+			wantUser:     true,
+		},
+		{
+			name:          "Provision new account",
+			claims:        verified,
+			autoProvision: true,
+			wantCode:      http.StatusSeeOther,
+			wantLocation:  "/",
+			wantUser:      true,
+		},
+		{
+			name:         "Provisioning disabled",
+			claims:       verified,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/signup",
+		},
+		{
+			name:          "Unverified email",
+			claims:        map[string]any{"email": aliceEmail, "email_verified": false},
+			autoProvision: true,
+			wantCode:      http.StatusSeeOther,
+			wantLocation:  "/user/login",
+		},
+		{
+			name:          "State mismatch",
+			claims:        verified,
+			existingUser:  true,
+			autoProvision: true,
+			state:         "forged",
+			wantCode:      http.StatusBadRequest,
+			wantUser:      true,
+		},
+		{
+			name:          "Nonce mismatch",
+			claims:        map[string]any{"email": aliceEmail, "email_verified": true, "nonce": "replayed"},
+			existingUser:  true,
+			autoProvision: true,
+			wantCode:      http.StatusBadRequest,
+			wantUser:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			idp := ssotest.NewIdP(t, "snippetbox", tt.claims)
+
+			app := newTestApplication(t)
+			app.ssoAutoProvision = tt.autoProvision
+			p, err := sso.NewProvider(ctx, sso.Config{
+				IssuerURL:    idp.URL,
+				ClientID:     "snippetbox",
+				ClientSecret: "secret",
+				RedirectURL:  "https://snippetbox.test/user/login/sso/callback",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.ssoProvider = p
+			ts := newTestServer(t, handler(app))
+
+			if tt.existingUser {
+				if err := app.userModel.Insert(ctx, "Alice", aliceEmail, testPassword); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			code, header, _ := ts.get(t, "/user/login/sso")
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			idpCode, state := ssotest.SignIn(t, header.Get("Location"))
+			if tt.state != "" {
+				state = tt.state
+			}
+			callback := "/user/login/sso/callback?" + url.Values{"code": {idpCode}, "state": {state}}.Encode()
+			code, header, _ = ts.get(t, callback)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+
+			// only a successful sign-in authenticates the user
+			code, _, _ = ts.get(t, "/snippet/create")
+			assert.Equal(t, code == http.StatusOK, tt.wantLocation == "/")
+
+			_, err = app.userModel.IDByEmail(ctx, aliceEmail)
+			assert.Equal(t, err == nil, tt.wantUser)
+
+			// the flow can't be completed twice
+			code, _, _ = ts.get(t, callback)
+			assert.Equal(t, code, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestSnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, header, _ := ts.get(t, "/snippet/create")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		ts.login(t, ts.Client(), "alice@example.com")
+
+		code, header, body := ts.get(t, "/snippet/create")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, header.Get("Cache-Control"), "no-store")
+		assert.Equal(t, strings.Contains(body, "<form action='/snippet/create' method='POST'>"), true)
+
+		form := url.Values{
+			fieldTitle:   {"Over the wintry forest"},
+			fieldContent: {"Over the wintry forest..."},
+			fieldExpires: {"7"},
+			"csrf_token": {extractCSRFToken(t, body)},
+		}
+		code, header, _ = ts.postForm(t, "/snippet/create", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/snippet/view/1")
+
+		code, _, body = ts.get(t, "/snippet/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "Snippet was successfully created!"), true)
+		assert.Equal(t, strings.Contains(body, "Over the wintry forest..."), true)
+	})
+
+	t.Run("Invalid form", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/create")
+
+		form := url.Values{
+			fieldTitle:   {""},
+			fieldContent: {"Over the wintry forest..."},
+			fieldExpires: {"2"},
+			"csrf_token": {extractCSRFToken(t, body)},
+		}
+		code, _, body := ts.postForm(t, "/snippet/create", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.Equal(t, strings.Contains(body, "this field cannot be blank"), true)
+		assert.Equal(t, strings.Contains(body, "this field must be one of 1, 7, or 365"), true)
+	})
+}
+
+func TestAccountSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// log in from two browsers
+	other := ts.newClient(t)
+	ts.login(t, ts.Client(), "alice@example.com")
+	ts.login(t, other, "alice@example.com")
+
+	code, _, body := ts.get(t, "/account/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Count(body, "Sign out</button>"), 1)
+
+	form := url.Values{
+		"csrf_token": {extractCSRFToken(t, body)},
+	}
+	code, header, _ := ts.postForm(t, "/account/sessions/revoke-others", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/sessions")
+
+	// the other browser is signed out on its next request
+	code, header, _ = ts.getWith(t, other, "/snippet/create")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	code, _, _ = ts.get(t, "/snippet/create")
+	assert.Equal(t, code, http.StatusOK)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// how long every readiness check may take
+const healthCheckTimeout = 2 * time.Second
+
+// healthCheck checks a dependency the application needs to serve requests
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// health reports whether the application is ready to serve requests
+type health struct {
+	checks []healthCheck
+	// set once the server starts shutting down
+	draining atomic.Bool
+}
+
+func newHealth(checks ...healthCheck) *health {
+	return &health{checks: checks}
+}
+
+// report not-ready from now on, so that load balancers stop sending requests
+func (h *health) drain() {
+	h.draining.Store(true)
+}
+
+// healthCheckResult is the outcome of a check in the readiness report
+type healthCheckResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+}
+
+// readinessReport is the body of the readiness endpoint
+type readinessReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]healthCheckResult `json:"checks"`
+}
+
+// run every check concurrently and report whether all of them passed
+// the errors of the failing checks are logged rather than exposed
+func (h *health) ready(ctx context.Context, logger *slog.Logger) (readinessReport, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	report := readinessReport{Checks: make(map[string]healthCheckResult, len(h.checks))}
+	ok := true
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, hc := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := hc.check(ctx)
+			result := healthCheckResult{Status: "ok", Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = "failing"
+				logger.WarnContext(ctx, "readiness check failed", slog.String("check", hc.name), slog.String("error", err.Error()))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[hc.name] = result
+			ok = ok && err == nil
+		}()
+	}
+	wg.Wait()
+
+	switch {
+	case h.draining.Load():
+		report.Status = "draining"
+		ok = false
+	case ok:
+		report.Status = "ready"
+	default:
+		report.Status = "not ready"
+	}
+	return report, ok
+}
+
+// check that the database behind the stores answers
+func databaseCheck(st *storage) healthCheck {
+	return healthCheck{name: "database", check: st.ping}
+}
+
+// check that the session store answers, by looking up a session that doesn't exist
+func sessionStoreCheck(store scs.Store) healthCheck {
+	return healthCheck{name: "sessions", check: func(ctx context.Context) error {
+		var err error
+		if cs, ok := store.(scs.CtxStore); ok {
+			_, _, err = cs.FindCtx(ctx, "readiness-check")
+		} else {
+			_, _, err = store.Find("readiness-check")
+		}
+		return err
+	}}
+}
+
+// check that the templates are parsed
+func templateCacheCheck(tc map[string]*template.Template) healthCheck {
+	return healthCheck{name: "templates", check: func(ctx context.Context) error {
+		if len(tc) == 0 {
+			return errors.New("no template is cached")
+		}
+		return nil
+	}}
+}
+
+// check that the schema of the database has every migration of this binary
+// a newer schema is fine, since instances of the previous binary keep serving during a rolling deploy
+// there is nothing to check if the stores are kept in memory
+func migrationCheck(st *storage) healthCheck {
+	return healthCheck{name: "migrations", check: func(ctx context.Context) error {
+		if st.migrator == nil {
+			return nil
+		}
+		version, err := st.migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		if latest := st.migrator.Latest(); version < latest {
+			return fmt.Errorf("schema version is %d, want at least %d", version, latest)
+		}
+		return nil
+	}}
+}
+
+// write v as a JSON response
+func writeJSON(w http.ResponseWriter, statusCode int, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
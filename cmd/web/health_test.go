@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+func TestHealthz(t *testing.T) {
+	app := newTestApplication(t)
+	app.health = newHealth(healthCheck{name: "database", check: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}})
+	ts := newTestServer(t, handler(app))
+
+	// liveness doesn't depend on the dependencies
+	code, header, body := ts.get(t, "/healthz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/json")
+	assert.Equal(t, body, `{"status":"ok"}`)
+}
+
+func TestReadyz(t *testing.T) {
+	passing := healthCheck{name: "templates", check: func(ctx context.Context) error {
+		return nil
+	}}
+	failing := healthCheck{name: "database", check: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}}
+	// a check must give up once its context is done
+	hanging := healthCheck{name: "sessions", check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tests := []struct {
+		name       string
+		checks     []healthCheck
+		draining   bool
+		wantCode   int
+		wantStatus string
+		wantChecks map[string]string
+	}{
+		{
+			name:       "Ready",
+			checks:     []healthCheck{passing},
+			wantCode:   http.StatusOK,
+			wantStatus: "ready",
+			wantChecks: map[string]string{"templates": "ok"},
+		},
+		{
+			name:       "Failing check",
+			checks:     []healthCheck{passing, failing, hanging},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "not ready",
+			wantChecks: map[string]string{"templates": "ok", "database": "failing", "sessions": "failing"},
+		},
+		{
+			name:       "Draining",
+			checks:     []healthCheck{passing},
+			draining:   true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "draining",
+			wantChecks: map[string]string{"templates": "ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.health = newHealth(tt.checks...)
+			if tt.draining {
+				app.health.drain()
+			}
+			ts := newTestServer(t, handler(app))
+
+			code, _, body := ts.get(t, "/readyz")
+			assert.Equal(t, code, tt.wantCode)
+
+			var report readinessReport
+			if err := json.Unmarshal([]byte(body), &report); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, report.Status, tt.wantStatus)
+			assert.Equal(t, len(report.Checks), len(tt.wantChecks))
+			for name, want := range tt.wantChecks {
+				assert.Equal(t, report.Checks[name].Status, want)
+			}
+		})
+	}
+}
+
+func TestReadyzDefaultChecks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	code, _, _ := ts.get(t, "/readyz")
+	assert.Equal(t, code, http.StatusOK)
+}
+
+func TestMigrationCheck(t *testing.T) {
+	ctx := context.Background()
+	st, err := openStorage(ctx, "sqlite:"+filepath.Join(t.TempDir(), "snippetbox.db"), testArgon2idParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(st.close)
+	check := migrationCheck(st).check
+
+	// no migration is applied yet
+	assert.Equal(t, check(ctx) != nil, true)
+
+	if _, err := st.migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, check(ctx), nil)
+
+	// a newer binary applied its migration, the instances of this one keep serving
+	stmt := `INSERT INTO schema_migration (version, name, applied) VALUES(?, 'from_the_future', CURRENT_TIMESTAMP)`
+	if _, err := st.db.ExecContext(ctx, stmt, st.migrator.Latest()+1); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, check(ctx), nil)
+
+	// a schema older than this binary isn't ready
+	if _, err := st.db.ExecContext(ctx, `DELETE FROM schema_migration WHERE version >= ?`, st.migrator.Latest()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, check(ctx) != nil, true)
+}
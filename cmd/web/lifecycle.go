@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// lifecycle runs the background workers of the application until it is stopped
+type lifecycle struct {
+	logger *slog.Logger
+	// canceled when the workers have to stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newLifecycle(logger *slog.Logger) *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// run the worker fn in its own goroutine
+// fn has to return once its context is canceled
+func (lc *lifecycle) start(name string, fn func(ctx context.Context)) {
+	lc.wg.Add(1)
+	go func() {
+		defer lc.wg.Done()
+
+		lc.logger.Info("started worker", slog.String("worker", name))
+		fn(lc.ctx)
+		lc.logger.Info("stopped worker", slog.String("worker", name))
+	}()
+}
+
+// run the job fn every interval until the lifecycle is stopped
+// a failed run is logged and retried on the next tick
+func (lc *lifecycle) every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	lc.start(name, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := fn(ctx); err != nil && ctx.Err() == nil {
+					lc.logger.Error(err.Error(), slog.String("worker", name))
+				}
+			}
+		}
+	})
+}
+
+// tell every worker to stop and wait for them
+// return the error of ctx if it is done before all of them have stopped
+func (lc *lifecycle) stop(ctx context.Context) error {
+	lc.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		lc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+
+	t.Run("Stop", func(t *testing.T) {
+		lc := newLifecycle(logger)
+
+		var runs atomic.Int32
+		ran := make(chan struct{}, 1)
+		lc.every("count", time.Millisecond, func(ctx context.Context) error {
+			runs.Add(1)
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+			return errors.New("failed runs are retried")
+		})
+		<-ran
+		<-ran
+
+		var stopped atomic.Bool
+		lc.start("wait", func(ctx context.Context) {
+			<-ctx.Done()
+			stopped.Store(true)
+		})
+
+		if err := lc.stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, stopped.Load(), true)
+
+		// no job runs once the lifecycle has stopped
+		n := runs.Load()
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal(t, runs.Load(), n)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		lc := newLifecycle(logger)
+
+		release := make(chan struct{})
+		defer close(release)
+		lc.start("stuck", func(ctx context.Context) {
+			<-release
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := lc.stop(ctx)
+		assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true)
+	})
+}
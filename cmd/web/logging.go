@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/lmittmann/tint"
+)
+
+// keys of the attributes whose values are never logged
+var sensitiveLogKeys = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"client_secret": true,
+	"token":         true,
+	"csrf_token":    true,
+}
+
+// build the log handler writing to w in the configured format and level
+// sensitive attributes are redacted and records logged with a request context carry the IDs of its trace
+func newLogHandler(cfg config, w io.Writer) slog.Handler {
+	var h slog.Handler
+	switch cfg.Log.Format {
+	case "json":
+		h = slog.NewJSONHandler(w, &slog.HandlerOptions{
+			AddSource:   true,
+			Level:       cfg.logLevel(),
+			ReplaceAttr: redactLogAttr,
+		})
+	default:
+		h = tint.NewHandler(w, &tint.Options{
+			AddSource:   true,
+			Level:       cfg.logLevel(),
+			ReplaceAttr: redactLogAttr,
+		})
+	}
+	return traceLogHandler{h}
+}
+
+// hide the value of sensitive attributes and the passwords of URIs and connection strings
+// it is a safety net, the callers still redact what they know to be secret, e.g. the database URI
+func redactLogAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindString {
+		return a
+	}
+	if sensitiveLogKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	v := a.Value.String()
+	if strings.Contains(v, "://") && strings.Contains(v, "@") || strings.Contains(strings.ToLower(v), "password") {
+		return slog.String(a.Key, redactURI(v))
+	}
+	return a
+}
@@ -2,104 +2,305 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/justinas/alice"
-	"github.com/lmittmann/tint"
 	"github.com/obzva/snippetbox/internal/model"
-)
-
-const (
-	snippetboxPort = "SNIPPETBOX_PORT"
-	databaseURI    = "DATABASE_URI"
+	"github.com/obzva/snippetbox/internal/sso"
+	"github.com/obzva/snippetbox/internal/validator"
+	"github.com/obzva/snippetbox/ui"
 )
 
 func main() {
-	// create a context that will be used throughout the application
-	ctx := context.Background()
+	// load configuration
+	// the first remaining argument names a subcommand, if any
+	cfg, opts, err := loadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if opts.printConfig {
+		if err := cfg.print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// initialize a logger
-	logHandler := tint.NewHandler(os.Stdout, &tint.Options{AddSource: true})
+	logHandler := newLogHandler(cfg, os.Stdout)
 	logger := slog.New(logHandler)
+	if opts.configPath != "" {
+		logger.Info("loaded config file", slog.String("path", opts.configPath))
+	}
 
-	// get env variables
-	dbURI := os.Getenv(databaseURI)
-	if dbURI == "" {
-		logger.Error("can't find env variable", slog.String("env-var", snippetboxPort))
+	if err := run(cfg, opts, logger, logHandler); err != nil {
+		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	port := os.Getenv(snippetboxPort)
-	if port == "" {
-		logger.Error("can't find env variable", slog.String("env-var", snippetboxPort))
-		os.Exit(1)
+}
+
+// run the subcommand, or the server until it receives SIGINT or SIGTERM
+// every resource is released before it returns
+func run(cfg config, opts options, logger *slog.Logger, logHandler slog.Handler) error {
+	// create a context that will be used throughout the application
+	// it is canceled by the first SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP is handled before any listener starts, so that it never kills the process
+	// it reloads the certificate files in file mode, the other modes have none and ignore it
+	hup := make(chan os.Signal, 1)
+	if cfg.TLS.Mode == tlsModeFile {
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	} else {
+		signal.Ignore(syscall.SIGHUP)
 	}
 
-	// initialize db connection pool
-	dbPool, err := pgxpool.New(ctx, dbURI)
+	// install the tracer provider
+	// pending spans are flushed once everything else is stopped
+	shutdownTracing, err := setupTracing(ctx, cfg)
 	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		return err
 	}
-	if err := dbPool.Ping(ctx); err != nil {
-		dbPool.Close()
-		logger.Error(err.Error())
-		os.Exit(1)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush traces", slog.String("error", err.Error()))
+		}
+	}()
+
+	// open stores
+	st, err := openStorage(ctx, cfg.DatabaseURI, cfg.argon2idParams())
+	if err != nil {
+		return err
+	}
+	defer st.close()
+	logger.Info("opened stores", slog.String("URI", redactURI(cfg.DatabaseURI)))
+
+	// run subcommand
+	if len(opts.args) > 0 {
+		return runMigrate(ctx, logger, st.migrator, opts.args[1:], os.Stdout)
+	}
+
+	// apply pending migrations
+	if cfg.Migrate && st.migrator != nil {
+		if err := migrateUp(ctx, logger, st.migrator); err != nil {
+			return err
+		}
 	}
-	defer dbPool.Close()
-	logger.Info("initialized db connection pool", slog.String("URI", dbURI))
 
 	// initialize template cache
-	tc, err := newTemplateCache()
+	a, err := newAssets(ui.Files)
 	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		return err
+	}
+	tc, err := newTemplateCache(a)
+	if err != nil {
+		return err
+	}
+
+	// load breached password list
+	var breachedPWs *validator.BreachedPasswords
+	if path := cfg.BreachedPasswordsFile; path != "" {
+		breachedPWs, err = validator.LoadBreachedPasswords(path)
+		if err != nil {
+			return err
+		}
+		defer breachedPWs.Close()
+		logger.Info("opened breached password list", slog.String("path", path))
+	}
+
+	// discover single sign-on identity provider
+	var ssoProvider *sso.Provider
+	if issuerURL := cfg.OIDC.IssuerURL; issuerURL != "" {
+		ssoProvider, err = sso.NewProvider(ctx, sso.Config{
+			IssuerURL:    issuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("discovered single sign-on identity provider", slog.String("issuer", issuerURL))
 	}
 
 	// initialize session manager
 	sm := scs.New()
-	sm.Store = pgxstore.New(dbPool)
-	sm.Lifetime = 12 * time.Hour
+	sm.Store = newTracedSessionStore(st.sessions)
+	sm.Lifetime = cfg.Session.Lifetime
+	// session cookies are browser session cookies unless the user chooses "remember me"
+	sm.Cookie.Persist = false
+
+	// validated along with the rest of the configuration
+	proxies, err := cfg.trustedProxyPrefixes()
+	if err != nil {
+		return err
+	}
 
 	// initialize app struct
 	app := &application{
-		logger: logger,
-		snippetModel: &model.SnippetModel{
-			DBPool: dbPool,
-		},
-		userModel: &model.UserModel{
-			DBPool: dbPool,
-		},
-		templateCache:  tc,
-		sessionManager: sm,
-	}
-
-	// chaining generalMW and mux
-	generalMW := alice.New(recoverPanic(app), logRequest(app), setCommonHeaders)
-	mux := routes(app)
-	chain := generalMW.Then(mux)
-
-	// start web server
+		logger:               logger,
+		snippetModel:         st.snippets,
+		userModel:            st.users,
+		userSessionModel:     st.userSessions,
+		templateCache:        tc,
+		sessionManager:       sm,
+		ssoProvider:          ssoProvider,
+		ssoAutoProvision:     cfg.OIDC.AutoProvision,
+		breachedPasswords:    breachedPWs,
+		sessionIdleTimeout:   cfg.Session.IdleTimeout,
+		rememberMeLifetime:   cfg.Session.RememberMeLifetime,
+		accessLogSampleRatio: cfg.Log.AccessSampleRatio,
+		trustedProxies:       proxies,
+		trustedHeader:        cfg.TrustedHeader,
+		assets:               a,
+		metrics:              newMetrics(),
+		health: newHealth(
+			databaseCheck(st),
+			sessionStoreCheck(st.sessions),
+			templateCacheCheck(tc),
+			migrationCheck(st),
+		),
+	}
+	app.metrics.registerStorage(st)
+	switch cfg.RateLimit.Backend {
+	case rateLimitBackendMemory:
+		app.rateLimits = model.NewMemoryRateLimitStore()
+	case rateLimitBackendDatabase:
+		app.rateLimits = st.rateLimits
+	}
+
+	// background workers are stopped before the stores are closed
+	lc := newLifecycle(logger)
+
+	// configure TLS
+	tlsConfig, redirectHandler, err := newTLSConfig(cfg, lc, hup)
+	if err != nil {
+		return err
+	}
+
+	// initialize web server and the plain HTTP listener
 	srv := &http.Server{
-		Addr:     port,
-		Handler:  chain,
-		ErrorLog: slog.NewLogLogger(logHandler, slog.LevelError),
-		TLSConfig: &tls.Config{
-			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
-		},
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  1 * time.Minute,
-	}
-	logger.Info("started server", slog.String("port", port))
-	if err := srv.ListenAndServeTLS("./tls/localhost.pem", "./tls/localhost-key.pem"); err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		Addr:         cfg.Addr,
+		Handler:      handler(app),
+		ErrorLog:     slog.NewLogLogger(logHandler, slog.LevelError),
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	servers := []*http.Server{srv}
+	var redirectSrv *http.Server
+	if redirectHandler != nil {
+		redirectSrv = &http.Server{
+			Addr:         cfg.TLS.RedirectAddr,
+			Handler:      redirectHandler,
+			ErrorLog:     slog.NewLogLogger(logHandler, slog.LevelError),
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		servers = append(servers, redirectSrv)
+	}
+	var adminSrv *http.Server
+	var adminLn net.Listener
+	if cfg.Admin.Addr != "" {
+		adminLn, err = listenAdmin(cfg.Admin.Addr)
+		if err != nil {
+			return err
+		}
+		publishVars(st)
+		adminSrv = &http.Server{
+			Addr:         cfg.Admin.Addr,
+			Handler:      adminRoutes(app),
+			ErrorLog:     slog.NewLogLogger(logHandler, slog.LevelError),
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		servers = append(servers, adminSrv)
+	}
+
+	// start background workers
+	if cfg.PurgeInterval > 0 {
+		lc.every("purge-expired-snippets", cfg.PurgeInterval, purgeExpiredSnippets(logger, st.snippets))
+		lc.every("purge-expired-user-sessions", cfg.PurgeInterval, purgeExpiredUserSessions(logger, st.userSessions))
+		if app.rateLimits != nil {
+			lc.every("purge-idle-rate-limits", cfg.PurgeInterval, purgeIdleRateLimits(logger, app.rateLimits))
+		}
+	}
+
+	// start servers
+	serveErr := make(chan error, len(servers))
+	go func() {
+		// a TLS-terminating proxy sits in front of the server in proxy mode
+		if srv.TLSConfig == nil {
+			serveErr <- srv.ListenAndServe()
+			return
+		}
+		serveErr <- srv.ListenAndServeTLS("", "")
+	}()
+	logger.Info("started server", slog.String("addr", cfg.Addr), slog.String("tls-mode", cfg.TLS.Mode))
+	if redirectSrv != nil {
+		go func() {
+			serveErr <- redirectSrv.ListenAndServe()
+		}()
+		logger.Info("started HTTP redirect server", slog.String("addr", redirectSrv.Addr))
+	}
+	if adminSrv != nil {
+		go func() {
+			serveErr <- adminSrv.Serve(adminLn)
+		}()
+		logger.Info("started admin server", slog.String("addr", adminSrv.Addr))
+	}
+
+	var srvErr error
+	select {
+	case srvErr = <-serveErr:
+	case <-ctx.Done():
+		logger.Info("shutting down server", slog.Duration("timeout", cfg.Server.ShutdownTimeout))
+	}
+	// a second signal kills the process right away
+	stop()
+
+	// keep serving while load balancers notice that the server isn't ready anymore
+	app.health.drain()
+	if srvErr == nil && cfg.Server.DrainDelay > 0 {
+		logger.Info("draining", slog.Duration("delay", cfg.Server.DrainDelay))
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+
+	// drain in-flight requests, then stop the workers
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			logger.Error("failed to drain requests", slog.String("addr", s.Addr), slog.String("error", err.Error()))
+		}
+	}
+	if err := lc.stop(shutdownCtx); err != nil {
+		logger.Error("failed to stop workers", slog.String("error", err.Error()))
+	}
+
+	if srvErr != nil && !errors.Is(srvErr, http.ErrServerClosed) {
+		return srvErr
 	}
+	logger.Info("stopped server")
+	return nil
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/obzva/snippetbox/internal/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "snippetbox"
+
+// metrics holds the Prometheus metrics of the application
+type metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	snippetsCreated prometheus.Counter
+	signups         prometheus.Counter
+	failedLogins    prometheus.Counter
+	rateLimited     *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route pattern and status code.",
+		}, []string{"pattern", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"pattern"}),
+		snippetsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "snippets_created_total",
+			Help:      "Number of snippets created.",
+		}),
+		signups: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "signups_total",
+			Help:      "Number of user accounts created.",
+		}),
+		failedLogins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "failed_logins_total",
+			Help:      "Number of logins rejected for invalid credentials.",
+		}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Number of requests rejected by rate limit policy.",
+		}, []string{"policy"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.snippetsCreated,
+		m.signups,
+		m.failedLogins,
+		m.rateLimited,
+	)
+	return m
+}
+
+// collect the connection statistics of the database behind the stores and the number of signed-in sessions
+func (m *metrics) registerStorage(st *storage) {
+	if st.dbPool != nil {
+		m.registry.MustRegister(newPoolCollector(st.dbPool))
+	}
+	if st.db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(st.db, "sqlite"))
+	}
+	m.registry.MustRegister(newUserSessionCollector(st.userSessions))
+}
+
+// return the handler serving the metrics in the Prometheus exposition format
+func (m *metrics) handler(logger *slog.Logger) http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	})
+}
+
+// record the count and latency of requests by the pattern of the route that served them
+// the raw URI isn't used so that the number of label values stays bounded
+func instrumentRequests(app *application) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := newResponseRecorder(w)
+
+			next.ServeHTTP(rec, r)
+
+			pattern := routePattern(r)
+			if pattern == "" {
+				pattern = "unmatched"
+			}
+			app.metrics.httpRequests.WithLabelValues(pattern, strconv.Itoa(rec.status)).Inc()
+			app.metrics.httpDuration.WithLabelValues(pattern).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// poolCollector collects the statistics of a PostgreSQL connection pool
+type poolCollector struct {
+	dbPool *pgxpool.Pool
+
+	acquiredConns     *prometheus.Desc
+	idleConns         *prometheus.Desc
+	constructingConns *prometheus.Desc
+	totalConns        *prometheus.Desc
+	maxConns          *prometheus.Desc
+	acquires          *prometheus.Desc
+	acquireDuration   *prometheus.Desc
+	canceledAcquires  *prometheus.Desc
+	emptyAcquires     *prometheus.Desc
+}
+
+func newPoolCollector(dbPool *pgxpool.Pool) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		dbPool:            dbPool,
+		acquiredConns:     desc("acquired_conns", "Number of connections currently in use."),
+		idleConns:         desc("idle_conns", "Number of idle connections."),
+		constructingConns: desc("constructing_conns", "Number of connections being established."),
+		totalConns:        desc("total_conns", "Number of connections in the pool."),
+		maxConns:          desc("max_conns", "Maximum size of the pool."),
+		acquires:          desc("acquires_total", "Number of successful connection acquires."),
+		acquireDuration:   desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		canceledAcquires:  desc("canceled_acquires_total", "Number of acquires canceled by their context."),
+		emptyAcquires:     desc("empty_acquires_total", "Number of acquires that waited for a connection."),
+	}
+}
+
+func (pc *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(pc, ch)
+}
+
+func (pc *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := pc.dbPool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(pc.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(pc.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(pc.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(pc.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(pc.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(pc.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pc.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(pc.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pc.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+}
+
+// userSessionCollector collects the number of signed-in sessions when the metrics are scraped
+type userSessionCollector struct {
+	store model.UserSessionStore
+	count *prometheus.Desc
+}
+
+func newUserSessionCollector(store model.UserSessionStore) *userSessionCollector {
+	return &userSessionCollector{
+		store: store,
+		count: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "user_sessions"), "Number of signed-in sessions.", nil, nil),
+	}
+}
+
+func (usc *userSessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usc.count
+}
+
+func (usc *userSessionCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	n, err := usc.store.Count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(usc.count, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(usc.count, prometheus.GaugeValue, float64(n))
+}
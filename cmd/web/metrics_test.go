@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+// scrape the metrics from the admin routes of the application
+func scrapeMetrics(t *testing.T, app *application) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	adminRoutes(app).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d scraping metrics", rr.Code)
+	}
+	return rr.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.snippetModel.Insert(context.Background(), "An old silent pond", "An old silent pond...", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.get(t, fmt.Sprintf("/snippet/view/%d", id))
+	ts.get(t, fmt.Sprintf("/snippet/view/%d", id+1))
+	ts.get(t, "/no/such/page")
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{
+		fieldEmail:    {"alice@example.com"},
+		fieldPassword: {"wrong password"},
+		"csrf_token":  {extractCSRFToken(t, body)},
+	}
+	ts.postForm(t, "/user/login", form)
+	ts.login(t, ts.Client(), "alice@example.com")
+
+	metrics := scrapeMetrics(t, app)
+
+	tests := []string{
+		// requests are labelled by route pattern, not by URI
+		`snippetbox_http_requests_total{code="200",pattern="GET /snippet/view/{id}"} 1`,
+		`snippetbox_http_requests_total{code="404",pattern="GET /snippet/view/{id}"} 1`,
+		`snippetbox_http_requests_total{code="404",pattern="unmatched"} 1`,
+		`snippetbox_http_request_duration_seconds_count{pattern="GET /snippet/view/{id}"} 2`,
+		`snippetbox_failed_logins_total 1`,
+		`snippetbox_user_sessions 1`,
+	}
+	for _, want := range tests {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics don't contain %q", want)
+		}
+	}
+	assert.Equal(t, strings.Contains(metrics, fmt.Sprintf("/snippet/view/%d", id)), false)
+}
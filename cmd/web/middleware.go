@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	crand "crypto/rand"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"time"
 
 	"github.com/justinas/nosurf"
+	"github.com/obzva/snippetbox/internal/model"
 )
 
 func setCommonHeaders(next http.Handler) http.Handler {
@@ -21,12 +26,32 @@ func setCommonHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// log one line per request once it's served, with the status code, size and latency of the response
+// only a sample of the requests is logged if the access log sample ratio is less than 1
 func logRequest(app *application) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			app.logger.Info("recieved a request", slog.String("ip", r.RemoteAddr), slog.String("protocol version", r.Proto), slog.String("method", r.Method), slog.String("uri", r.URL.RequestURI()))
+			start := time.Now()
+			rec := newResponseRecorder(w)
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(rec, r)
+
+			// server errors are always logged
+			if rec.status < http.StatusInternalServerError && rand.Float64() >= app.accessLogSampleRatio {
+				return
+			}
+
+			app.logger.InfoContext(r.Context(), "served a request",
+				slog.String(keyRequestID, requestID(r.Context())),
+				slog.String("ip", remoteIP(r)),
+				slog.String("protocol version", r.Proto),
+				slog.String(keyMethod, r.Method),
+				// the query isn't logged since it may hold secrets, e.g. the code of the single sign-on callback
+				slog.String(keyPath, r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Int("size", rec.size),
+				slog.Duration("duration", time.Since(start)),
+			)
 		})
 	}
 }
@@ -85,13 +110,149 @@ func authenticate(app *application) func(next http.Handler) http.Handler {
 				app.serverError(w, r, err.Error())
 				return
 			}
-			if ok { // the current user is valid and authenticated
-				ctx := r.Context()
-				ctx = context.WithValue(ctx, ctxKeyAuth, true)
-				r = r.WithContext(ctx)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the signed-in session should not have been revoked
+			sessionID := app.sessionManager.GetString(r.Context(), sessionKeySessionID)
+			lastSeen, err := app.userSessionModel.Touch(r.Context(), sessionID, id)
+			if err != nil {
+				if errors.Is(err, model.ErrNoRecord) {
+					app.sessionManager.Remove(r.Context(), sessionKeyAuth)
+					app.sessionManager.Remove(r.Context(), sessionKeySessionID)
+					next.ServeHTTP(w, r)
+				} else {
+					app.serverError(w, r, err.Error())
+				}
+				return
+			}
+
+			// sessions without "remember me" are signed out after being inactive for a while
+			if !app.sessionManager.GetBool(r.Context(), sessionKeyRememberMe) && app.sessionIdleTimeout > 0 && time.Since(lastSeen) > app.sessionIdleTimeout {
+				if err := app.endUserSession(r); err != nil {
+					app.serverError(w, r, err.Error())
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
 			}
 
+			// the current user is valid and authenticated
+			ctx := r.Context()
+			ctx = context.WithValue(ctx, ctxKeyAuth, true)
+			r = r.WithContext(ctx)
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+const (
+	headerRequestID = "X-Request-ID"
+	// maximum length of a request ID accepted from the client
+	maxRequestIDLen = 128
+)
+
+// identify every request by the X-Request-ID header of the client, or by a new random ID
+// the ID is sent back in the X-Request-ID header and can be read with requestID
+func assignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestID)
+		if !validRequestID(id) {
+			id = crand.Text()
+		}
+
+		w.Header().Set(headerRequestID, id)
+		ctx := context.WithValue(r.Context(), ctxKeyRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// report whether id can be used as a request ID
+// it shouldn't be able to forge log lines or response headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// return the ID of the request the context belongs to, empty if it has none
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// let the middleware in front of the mux read the pattern of the matched route with routePattern
+// the mux sets it only on the request it receives, which may be a copy made by the middleware in between
+func withRoutePattern(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ctxKeyRoutePattern, new(string))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// record the pattern of the route matched by mux for withRoutePattern
+func recordRoutePattern(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the pattern is recorded even if the handler panics
+		defer func() {
+			if p, ok := r.Context().Value(ctxKeyRoutePattern).(*string); ok {
+				*p = r.Pattern
+			}
+		}()
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// return the pattern of the route that served r, empty if no route matched
+func routePattern(r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	if p, ok := r.Context().Value(ctxKeyRoutePattern).(*string); ok {
+		return *p
+	}
+	return ""
+}
+
+// responseRecorder records the status code and size of the response written through it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if !rr.wroteHeader {
+		rr.status = code
+		// informational responses are followed by the final one
+		rr.wroteHeader = code >= 200
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	n, err := rr.ResponseWriter.Write(b)
+	rr.size += n
+	return n, err
+}
+
+// let http.ResponseController reach the underlying response writer
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
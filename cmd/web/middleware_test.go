@@ -2,12 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/obzva/snippetbox/internal/assert"
+	"github.com/obzva/snippetbox/internal/model"
 )
 
 func TestSetCommonHeaders(t *testing.T) {
@@ -70,3 +75,141 @@ func TestSetCommonHeaders(t *testing.T) {
 	body = bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestAssignRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		// whether the ID of the client is kept
+		kept bool
+	}{
+		{name: "No ID", header: "", kept: false},
+		{name: "Valid ID", header: "f47ac10b-58cc-4372-a567-0e02b2c3d479", kept: true},
+		{name: "Forged log line", header: "abc\nlevel=ERROR", kept: false},
+		{name: "Too long", header: strings.Repeat("a", maxRequestIDLen+1), kept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotID = requestID(r.Context())
+			})
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(headerRequestID, tt.header)
+			assignRequestID(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Header().Get(headerRequestID), gotID)
+			assert.Equal(t, gotID == tt.header, tt.kept)
+			assert.Equal(t, gotID != "", true)
+		})
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/brew?code=s3cret", nil)
+	req.Header.Set(headerRequestID, "brew-1")
+	assignRequestID(logRequest(app)(next)).ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, line[keyRequestID], any("brew-1"))
+	assert.Equal(t, line[keyMethod], any(http.MethodPost))
+	assert.Equal(t, line[keyPath], any("/brew"))
+	assert.Equal(t, strings.Contains(buf.String(), "s3cret"), false)
+	assert.Equal(t, line["status"], any(float64(http.StatusTeapot)))
+	assert.Equal(t, line["size"], any(float64(len("short and stout"))))
+	_, ok := line["duration"]
+	assert.Equal(t, ok, true)
+}
+
+func TestServerErrorRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(headerRequestID, "oops-1")
+	assignRequestID(recoverPanic(app)(next)).ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "request ID: oops-1"), true)
+	assert.Equal(t, strings.Contains(buf.String(), `"request_id":"oops-1"`), true)
+}
+
+// panickingSnippetStore panics when the latest snippets are listed
+type panickingSnippetStore struct {
+	model.SnippetStore
+}
+
+func (panickingSnippetStore) Latest(ctx context.Context) ([]model.Snippet, error) {
+	panic("oops")
+}
+
+func TestRecoverPanicCompressed(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	app.snippetModel = panickingSnippetStore{app.snippetModel}
+	ts := newTestServer(t, handler(app))
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ := readResponse(t, res)
+
+	// the panic is a server error for the client and for the access log alike
+	assert.Equal(t, code, http.StatusInternalServerError)
+	assert.Equal(t, strings.Contains(buf.String(), `"status":500`), true)
+}
+
+func TestLogRequestSampling(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   bool
+	}{
+		{name: "Success is sampled out", status: http.StatusOK, want: false},
+		{name: "Server error is kept", status: http.StatusInternalServerError, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newTestApplication(t)
+			app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+			app.accessLogSampleRatio = 0
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			})
+			logRequest(app)(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, buf.Len() > 0, tt.want)
+		})
+	}
+}
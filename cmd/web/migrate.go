@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/obzva/snippetbox/internal/migration"
+)
+
+// migrate subcommand and its args, shared with the usage of the flags
+const (
+	migrateCommand = "migrate up|down|status|baseline <version>"
+	migrateUsage   = "usage: web " + migrateCommand
+)
+
+// run the migrate subcommand with its args
+// m is nil if the database has no schema to migrate
+func runMigrate(ctx context.Context, logger *slog.Logger, m migration.Migrator, args []string, w io.Writer) error {
+	wantArgs := 1
+	if len(args) > 0 && args[0] == "baseline" {
+		wantArgs = 2
+	}
+	if len(args) != wantArgs {
+		return errors.New(migrateUsage)
+	}
+	if m == nil {
+		return errors.New("migrations apply only to PostgreSQL and SQLite databases")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, logger, m)
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info("rolled back migration", slog.Int("version", mig.Version), slog.String("name", mig.Name))
+		return nil
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = prettifyDate(s.Applied)
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	case "baseline":
+		// a schema created before the migrations were recorded, e.g. by hand, is adopted at this version
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errors.New(migrateUsage)
+		}
+		recorded, err := m.Baseline(ctx, version)
+		if err != nil {
+			return err
+		}
+		for _, mig := range recorded {
+			logger.Info("recorded migration as applied", slog.Int("version", mig.Version), slog.String("name", mig.Name))
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// apply every pending migration
+func migrateUp(ctx context.Context, logger *slog.Logger, m migration.Migrator) error {
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		logger.Info("applied migration", slog.Int("version", mig.Version), slog.String("name", mig.Name))
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		logger.Info("database schema is up to date", slog.Int("version", m.Latest()))
+	}
+	return nil
+}
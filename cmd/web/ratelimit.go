@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rate limiter backends
+const (
+	rateLimitBackendMemory   = "memory"
+	rateLimitBackendDatabase = "database"
+)
+
+// rateLimitPolicy is a token bucket limiting how often a client may call a route
+type rateLimitPolicy struct {
+	// name of the policy, it prefixes the keys of its buckets
+	name string
+	// tokens added per second
+	rate float64
+	// maximum number of requests in a burst
+	burst int
+}
+
+// how long it takes an empty bucket of the policy to fill up
+func (p rateLimitPolicy) refillTime() time.Duration {
+	return time.Duration(float64(p.burst) / p.rate * float64(time.Second))
+}
+
+var (
+	signupRateLimit        = rateLimitPolicy{name: "signup", rate: 1.0 / 60, burst: 5}
+	loginRateLimit         = rateLimitPolicy{name: "login", rate: 1.0 / 6, burst: 10}
+	snippetCreateRateLimit = rateLimitPolicy{name: "snippet-create", rate: 1.0 / 10, burst: 10}
+)
+
+// every policy in use, to know when the buckets can be forgotten
+var rateLimitPolicies = []rateLimitPolicy{signupRateLimit, loginRateLimit, snippetCreateRateLimit}
+
+// limit the requests of every client with the policy and reply 429 to the ones over the limit
+// authenticated users are told apart by user id, others by IP address
+// it must come after authenticate in the chain
+func rateLimit(app *application, p rateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.rateLimits == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := p.name + ":ip:" + remoteIP(r)
+			if app.checkAuthenticated(r.Context()) {
+				key = p.name + ":user:" + strconv.Itoa(app.sessionManager.GetInt(r.Context(), sessionKeyAuth))
+			}
+
+			ok, retryAfter, err := app.rateLimits.Take(r.Context(), key, p.rate, p.burst)
+			if err != nil {
+				// an unavailable limiter shouldn't take the site down with it
+				app.logger.ErrorContext(r.Context(), "failed to check rate limit", slog.String("policy", p.name), slog.String("error", err.Error()))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ok {
+				app.metrics.rateLimited.WithLabelValues(p.name).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				app.clientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
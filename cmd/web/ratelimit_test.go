@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+	"github.com/obzva/snippetbox/internal/model"
+)
+
+func TestRateLimitAnonymous(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimits = model.NewMemoryRateLimitStore()
+	ts := newTestServer(t, handler(app))
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{
+		fieldEmail:    {"alice@example.com"},
+		fieldPassword: {"wrong password"},
+		"csrf_token":  {extractCSRFToken(t, body)},
+	}
+
+	for range loginRateLimit.burst {
+		code, _, _ := ts.postForm(t, "/user/login", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	code, header, _ := ts.postForm(t, "/user/login", form)
+	assert.Equal(t, code, http.StatusTooManyRequests)
+	assert.Equal(t, header.Get("Retry-After"), "6")
+
+	// other routes have their own buckets
+	code, _, _ = ts.get(t, "/user/login")
+	assert.Equal(t, code, http.StatusOK)
+
+	metrics := scrapeMetrics(t, app)
+	assert.Equal(t, strings.Contains(metrics, `snippetbox_rate_limited_requests_total{policy="login"} 1`), true)
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	app := newTestApplication(t)
+	app.rateLimits = model.NewMemoryRateLimitStore()
+	ts := newTestServer(t, handler(app))
+
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		if err := app.userModel.Insert(context.Background(), "Someone", email, testPassword); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alice := ts.Client()
+	bob := ts.newClient(t)
+	ts.login(t, alice, "alice@example.com")
+	ts.login(t, bob, "bob@example.com")
+
+	// users share the IP address but not their buckets
+	createSnippet := func(client *http.Client) int {
+		_, _, body := ts.getWith(t, client, "/snippet/create")
+		form := url.Values{
+			fieldTitle:   {"Over the wintry forest"},
+			fieldContent: {"Over the wintry forest..."},
+			fieldExpires: {"7"},
+			"csrf_token": {extractCSRFToken(t, body)},
+		}
+		code, _, _ := ts.postFormWith(t, client, "/snippet/create", form)
+		return code
+	}
+
+	for range snippetCreateRateLimit.burst {
+		assert.Equal(t, createSnippet(alice), http.StatusSeeOther)
+	}
+	assert.Equal(t, createSnippet(alice), http.StatusTooManyRequests)
+	assert.Equal(t, createSnippet(bob), http.StatusSeeOther)
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{
+		fieldEmail:    {"alice@example.com"},
+		fieldPassword: {"wrong password"},
+		"csrf_token":  {extractCSRFToken(t, body)},
+	}
+
+	for range loginRateLimit.burst + 1 {
+		code, _, _ := ts.postForm(t, "/user/login", form)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+}
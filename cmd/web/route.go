@@ -4,18 +4,27 @@ import (
 	"net/http"
 
 	"github.com/justinas/alice"
-	"github.com/obzva/snippetbox/ui"
 )
 
+// wrap the routes in the middleware every request goes through
+// panics are recovered inside the compressor, which would otherwise commit a 200 while the panic unwinds
+func handler(app *application) http.Handler {
+	generalMW := alice.New(withRoutePattern, assignRequestID, resolveClientIP(app), traceRequests, instrumentRequests(app), logRequest(app), compressResponses, recoverPanic(app), setCommonHeaders)
+	return generalMW.Then(recordRoutePattern(routes(app)))
+}
+
 func routes(app *application) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// ping
 	mux.HandleFunc("GET /ping", ping(app))
 
+	// health
+	mux.HandleFunc("GET /healthz", getHealthz(app))
+	mux.HandleFunc("GET /readyz", getReadyz(app))
+
 	// static
-	fs := http.FileServerFS(ui.Files)
-	mux.Handle("GET /static/", fs)
+	mux.Handle("GET /static/", serveStatic(app.assets))
 
 	// session manager middleware
 	smMW := alice.New(app.sessionManager.LoadAndSave, preventCSRF, authenticate(app))
@@ -29,12 +38,21 @@ func routes(app *application) *http.ServeMux {
 	mux.Handle("GET /snippet/create", reqAuth.ThenFunc(getSnippetCreate(app)))
 	mux.Handle("GET /user/signup", smMW.ThenFunc(getUserSignup(app)))
 	mux.Handle("GET /user/login", smMW.ThenFunc(getUserLogin(app)))
+	mux.Handle("GET /account/sessions", reqAuth.ThenFunc(getAccountSessions(app)))
+
+	// single sign-on
+	if app.ssoProvider != nil {
+		mux.Handle("GET /user/login/sso", smMW.ThenFunc(getUserLoginSSO(app)))
+		mux.Handle("GET /user/login/sso/callback", smMW.ThenFunc(getUserLoginSSOCallback(app)))
+	}
 
 	// post
-	mux.Handle("POST /snippet/create", reqAuth.ThenFunc(postSnippetCreate(app)))
-	mux.Handle("POST /user/signup", smMW.ThenFunc(postUserSignup(app)))
-	mux.Handle("POST /user/login", smMW.ThenFunc(postUserLogin(app)))
+	mux.Handle("POST /snippet/create", reqAuth.Append(rateLimit(app, snippetCreateRateLimit)).ThenFunc(postSnippetCreate(app)))
+	mux.Handle("POST /user/signup", smMW.Append(rateLimit(app, signupRateLimit)).ThenFunc(postUserSignup(app)))
+	mux.Handle("POST /user/login", smMW.Append(rateLimit(app, loginRateLimit)).ThenFunc(postUserLogin(app)))
 	mux.Handle("POST /user/logout", reqAuth.ThenFunc(postUserLogout(app)))
+	mux.Handle("POST /account/sessions/revoke-others", reqAuth.ThenFunc(postAccountSessionsRevokeOthers(app)))
+	mux.Handle("POST /account/sessions/{id}/revoke", reqAuth.ThenFunc(postAccountSessionRevoke(app)))
 
 	return mux
 }
@@ -1,6 +1,12 @@
 package main
 
 const (
-	sessionKeyFlash = "flash"
-	sessionKeyAuth  = "authenticatedUserID"
+	sessionKeyFlash      = "flash"
+	sessionKeyAuth       = "authenticatedUserID"
+	sessionKeySessionID  = "userSessionID"
+	sessionKeyRememberMe = "rememberMe"
+	// secrets of the single sign-on flow in progress
+	sessionKeySSOState    = "ssoState"
+	sessionKeySSONonce    = "ssoNonce"
+	sessionKeySSOVerifier = "ssoVerifier"
 )
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/alexedwards/scs/pgxstore"
+	"github.com/alexedwards/scs/sqlite3store"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/obzva/snippetbox/internal/migration"
+	"github.com/obzva/snippetbox/internal/model"
+)
+
+// storage holds the stores of the application and the resources behind them
+type storage struct {
+	snippets     model.SnippetStore
+	users        model.UserStore
+	userSessions model.UserSessionStore
+	sessions     scs.Store
+	// token buckets shared by every instance using the database
+	rateLimits model.RateLimitStore
+	// nil if the stores are kept in memory
+	migrator migration.Migrator
+	// nil unless the stores are backed by PostgreSQL
+	dbPool *pgxpool.Pool
+	// nil unless the stores are backed by SQLite
+	db *sql.DB
+}
+
+// open the stores selected by the scheme of the database URI
+//   - postgres://, postgresql:// stores everything in PostgreSQL
+//   - sqlite:path/to/file.db, sqlite:///abs/path/to/file.db stores everything in a SQLite file
+//   - memory:// keeps everything in memory and loses it on exit
+func openStorage(ctx context.Context, dbURI string, pwParams model.Argon2idParams) (*storage, error) {
+	u, err := url.Parse(dbURI)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		poolConfig, err := pgxpool.ParseConfig(dbURI)
+		if err != nil {
+			return nil, err
+		}
+		poolConfig.ConnConfig.Tracer = pgxTracer{}
+
+		dbPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := dbPool.Ping(ctx); err != nil {
+			dbPool.Close()
+			return nil, err
+		}
+
+		m, err := migration.NewPostgresMigrator(dbPool)
+		if err != nil {
+			dbPool.Close()
+			return nil, err
+		}
+
+		s := &storage{
+			snippets: &model.SnippetModel{
+				DBPool: dbPool,
+			},
+			users: &model.UserModel{
+				DBPool:         dbPool,
+				PasswordParams: pwParams,
+			},
+			userSessions: &model.UserSessionModel{
+				DBPool: dbPool,
+			},
+			sessions: pgxstore.New(dbPool),
+			rateLimits: &model.RateLimitModel{
+				DBPool: dbPool,
+			},
+			migrator: m,
+			dbPool:   dbPool,
+		}
+		return s, nil
+	case "sqlite":
+		path := u.Opaque
+		if path == "" {
+			path = u.Host + u.Path
+		}
+		if path == "" {
+			return nil, fmt.Errorf("missing file path in database URI %q", dbURI)
+		}
+
+		db, err := model.OpenSQLite(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.PingContext(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		m, err := migration.NewSQLiteMigrator(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		s := &storage{
+			snippets: &model.SQLiteSnippetModel{
+				DB: db,
+			},
+			users: &model.SQLiteUserModel{
+				DB:             db,
+				PasswordParams: pwParams,
+			},
+			userSessions: &model.SQLiteUserSessionModel{
+				DB: db,
+			},
+			sessions: sqlite3store.New(db),
+			rateLimits: &model.SQLiteRateLimitModel{
+				DB: db,
+			},
+			migrator: m,
+			db:       db,
+		}
+		return s, nil
+	case "memory":
+		s := &storage{
+			snippets:     model.NewMemorySnippetStore(),
+			users:        model.NewMemoryUserStore(pwParams),
+			userSessions: model.NewMemoryUserSessionStore(),
+			sessions:     memstore.New(),
+			rateLimits:   model.NewMemoryRateLimitStore(),
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported database URI scheme %q", u.Scheme)
+	}
+}
+
+// check that the database behind the stores answers
+func (s *storage) ping(ctx context.Context) error {
+	switch {
+	case s.dbPool != nil:
+		return s.dbPool.Ping(ctx)
+	case s.db != nil:
+		return s.db.PingContext(ctx)
+	default:
+		return nil
+	}
+}
+
+// release the resources behind the stores
+func (s *storage) close() {
+	// stop deleting expired sessions in the background before the database goes away
+	if c, ok := s.sessions.(interface{ StopCleanup() }); ok {
+		c.StopCleanup()
+	}
+	if s.dbPool != nil {
+		s.dbPool.Close()
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+}
@@ -13,15 +13,18 @@ import (
 )
 
 type templateData struct {
-	CurrentYear    int
-	Snippet        model.Snippet
-	Snippets       []model.Snippet
-	Form           any
-	FieldErrors    map[string]error
-	NonFieldErrors []error
-	Flash          string
-	Authenticated  bool
-	CSRFToken      string
+	CurrentYear      int
+	Snippet          model.Snippet
+	Snippets         []model.Snippet
+	Form             any
+	FieldErrors      map[string]error
+	NonFieldErrors   []error
+	Flash            string
+	Authenticated    bool
+	CSRFToken        string
+	SSOEnabled       bool
+	UserSessions     []model.UserSession
+	CurrentSessionID string
 }
 
 func newTemplateData(app *application, r *http.Request) templateData {
@@ -30,11 +33,12 @@ func newTemplateData(app *application, r *http.Request) templateData {
 		Flash:         app.sessionManager.PopString(r.Context(), sessionKeyFlash),
 		Authenticated: app.checkAuthenticated(r.Context()),
 		CSRFToken:     nosurf.Token(r),
+		SSOEnabled:    app.ssoProvider != nil,
 	}
 	return td
 }
 
-func newTemplateCache() (map[string]*template.Template, error) {
+func newTemplateCache(a *assets) (map[string]*template.Template, error) {
 	cache := make(map[string]*template.Template)
 
 	pages, err := fs.Glob(ui.Files, "html/page/*.tmpl")
@@ -44,6 +48,7 @@ func newTemplateCache() (map[string]*template.Template, error) {
 
 	customFuncs := template.FuncMap{
 		"prettifyDate": prettifyDate,
+		"asset":        a.url,
 	}
 
 	for _, page := range pages {
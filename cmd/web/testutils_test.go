@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/obzva/snippetbox/internal/model"
+	"github.com/obzva/snippetbox/ui"
+)
+
+// cheap argon2id parameters to keep the tests fast
+var testArgon2idParams = model.Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// build an application with in-memory stores
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	a, err := newAssets(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc, err := newTemplateCache(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := scs.New()
+	sm.Store = newTracedSessionStore(memstore.New())
+	sm.Lifetime = 12 * time.Hour
+	sm.Cookie.Persist = false
+	sm.Cookie.Secure = true
+
+	app := &application{
+		logger:               slog.New(slog.DiscardHandler),
+		snippetModel:         model.NewMemorySnippetStore(),
+		userModel:            model.NewMemoryUserStore(testArgon2idParams),
+		userSessionModel:     model.NewMemoryUserSessionStore(),
+		templateCache:        tc,
+		sessionManager:       sm,
+		sessionIdleTimeout:   1 * time.Hour,
+		rememberMeLifetime:   30 * 24 * time.Hour,
+		accessLogSampleRatio: 1,
+		metrics:              newMetrics(),
+		assets:               a,
+	}
+	app.health = newHealth(sessionStoreCheck(sm.Store), templateCacheCheck(tc))
+	app.metrics.registry.MustRegister(newUserSessionCollector(app.userSessionModel))
+	return app
+}
+
+// testServer is a TLS test server whose client keeps cookies and doesn't follow redirects
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	ts.Client().Jar = newCookieJar(t)
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testServer{ts}
+}
+
+func newCookieJar(t *testing.T) *cookiejar.Jar {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jar
+}
+
+// return a client of the test server with its own cookie jar, i.e. another browser
+func (ts *testServer) newClient(t *testing.T) *http.Client {
+	t.Helper()
+
+	client := *ts.Client()
+	client.Jar = newCookieJar(t)
+	return &client
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	return ts.getWith(t, ts.Client(), urlPath)
+}
+
+func (ts *testServer) getWith(t *testing.T, client *http.Client, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	res, err := client.Get(ts.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, res)
+}
+
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	return ts.postFormWith(t, ts.Client(), urlPath, form)
+}
+
+func (ts *testServer) postFormWith(t *testing.T, client *http.Client, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	res, err := client.PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, res)
+}
+
+func readResponse(t *testing.T, res *http.Response) (int, http.Header, string) {
+	t.Helper()
+
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = bytes.TrimSpace(body)
+
+	return res.StatusCode, res.Header, string(body)
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value=([^\s>]+)>`)
+
+// extract the CSRF token from a rendered form
+func extractCSRFToken(t *testing.T, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+
+	return html.UnescapeString(matches[1])
+}
+
+// log in as the user with this email and testPassword with the client
+func (ts *testServer) login(t *testing.T, client *http.Client, email string) {
+	t.Helper()
+
+	ts.loginRememberMe(t, client, email, false)
+}
+
+// log in as the user with this email and testPassword with the client, asking to be remembered if rememberMe is true,
+// and return the header of the response
+func (ts *testServer) loginRememberMe(t *testing.T, client *http.Client, email string, rememberMe bool) http.Header {
+	t.Helper()
+
+	_, _, body := ts.getWith(t, client, "/user/login")
+	form := url.Values{
+		fieldEmail:    {email},
+		fieldPassword: {testPassword},
+		"csrf_token":  {extractCSRFToken(t, body)},
+	}
+	if rememberMe {
+		form.Set(fieldRememberMe, "true")
+	}
+
+	code, header, _ := ts.postFormWith(t, client, "/user/login", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/" {
+		t.Fatalf("failed to log in as %s: status %d", email, code)
+	}
+	return header
+}
+
+const testPassword = "plum tractor sunset"
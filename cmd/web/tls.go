@@ -0,0 +1,92 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS modes
+const (
+	tlsModeFile  = "file"
+	tlsModeACME  = "acme"
+	tlsModeProxy = "proxy"
+)
+
+// return the TLS config of the server for the TLS mode, nil in proxy mode,
+// and the handler of the plain HTTP listener, nil if it is disabled
+// in file mode, the certificate is reloaded by a worker of lc when its files change or on every signal of hup
+func newTLSConfig(cfg config, lc *lifecycle, hup <-chan os.Signal) (*tls.Config, http.Handler, error) {
+	var redirect http.Handler
+	if cfg.TLS.RedirectAddr != "" {
+		redirect = redirectToHTTPS(cfg.Addr)
+	}
+
+	tlsConfig := &tls.Config{
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}
+
+	switch cfg.TLS.Mode {
+	case tlsModeProxy:
+		return nil, nil, nil
+	case tlsModeACME:
+		m := newACMEManager(cfg, nil)
+		tlsConfig.GetCertificate = m.GetCertificate
+		// answer tls-alpn-01 challenges too
+		tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+		return tlsConfig, m.HTTPHandler(redirect), nil
+	default:
+		cr, err := newCertReloader(lc.logger, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.GetCertificate = cr.GetCertificate
+		lc.start("reload-certificate", cr.watch(cfg.TLS.ReloadInterval, hup))
+		return tlsConfig, redirect, nil
+	}
+}
+
+// return a manager that obtains and renews the certificates of the ACME domains
+// the ACME server is reached with httpClient, http.DefaultClient if nil
+func newACMEManager(cfg config, httpClient *http.Client) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.TLS.ACME.CacheDir),
+		HostPolicy: autocert.HostWhitelist(cfg.TLS.ACME.Domains...),
+		Email:      cfg.TLS.ACME.Email,
+		Client: &acme.Client{
+			DirectoryURL: cmp.Or(cfg.TLS.ACME.DirectoryURL, autocert.DefaultACMEDirectory),
+			HTTPClient:   httpClient,
+		},
+	}
+}
+
+// redirect every request to the same URL over HTTPS on the port of the server address addr
+func redirectToHTTPS(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// keep the method and body of requests other than GET and HEAD
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
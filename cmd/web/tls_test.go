@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name         string
+		addr         string
+		method       string
+		target       string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Default port",
+			addr:         ":443",
+			method:       http.MethodGet,
+			target:       "http://example.com/snippet/view/1?page=2",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://example.com/snippet/view/1?page=2",
+		},
+		{
+			name:         "Other port",
+			addr:         ":4000",
+			method:       http.MethodGet,
+			target:       "http://example.com:8080/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://example.com:4000/",
+		},
+		{
+			name:         "IPv6 host",
+			addr:         ":443",
+			method:       http.MethodHead,
+			target:       "http://[::1]:8080/ping",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "https://[::1]/ping",
+		},
+		{
+			name:         "Post",
+			addr:         ":443",
+			method:       http.MethodPost,
+			target:       "http://example.com/user/login",
+			wantCode:     http.StatusPermanentRedirect,
+			wantLocation: "https://example.com/user/login",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+
+			redirectToHTTPS(tt.addr).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, tt.wantCode)
+			assert.Equal(t, rr.Header().Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Run("Proxy", func(t *testing.T) {
+		cfg := defaultConfig()
+		cfg.TLS.Mode = tlsModeProxy
+
+		tlsConfig, redirect, err := newTLSConfig(cfg, newLifecycle(slog.New(slog.DiscardHandler)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tlsConfig == nil, true)
+		assert.Equal(t, redirect == nil, true)
+	})
+
+	t.Run("ACME", func(t *testing.T) {
+		cfg := defaultConfig()
+		cfg.TLS.Mode = tlsModeACME
+		cfg.TLS.RedirectAddr = ":80"
+		cfg.TLS.ACME.Domains = []string{"example.com"}
+		cfg.TLS.ACME.CacheDir = t.TempDir()
+
+		tlsConfig, redirect, err := newTLSConfig(cfg, newLifecycle(slog.New(slog.DiscardHandler)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tlsConfig.GetCertificate != nil, true)
+
+		// everything but ACME challenges is redirected
+		rr := httptest.NewRecorder()
+		redirect.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		assert.Equal(t, rr.Code, http.StatusMovedPermanently)
+		assert.Equal(t, rr.Header().Get("Location"), "https://example.com:4000/")
+
+		// challenges for unknown tokens are answered by the manager rather than redirected
+		rr = httptest.NewRecorder()
+		redirect.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/unknown", nil))
+		assert.Equal(t, rr.Code, http.StatusNotFound)
+	})
+}
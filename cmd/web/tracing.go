@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracing exporters
+const (
+	tracingExporterOTLP   = "otlp"
+	tracingExporterStdout = "stdout"
+	tracingExporterFile   = "file"
+)
+
+// tracer of the application, it delegates to the global tracer provider
+var tracer = otel.Tracer("github.com/obzva/snippetbox")
+
+// install the global tracer provider exporting spans with the configured exporter
+// return a function that flushes the pending spans and stops the provider
+// nothing is exported if no exporter is configured
+func setupTracing(ctx context.Context, cfg config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch cfg.Tracing.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case tracingExporterOTLP:
+		var opts []otlptracehttp.Option
+		// the OTEL_EXPORTER_OTLP_* env variables apply otherwise
+		if cfg.Tracing.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Tracing.Endpoint))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		exporter = exp
+	case tracingExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		exporter = exp
+	case tracingExporterFile:
+		f, err := os.OpenFile(cfg.Tracing.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		exporter = exp
+		closeFile = f.Close
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("snippetbox"))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	shutdown := func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closeFile != nil {
+			err = errors.Join(err, closeFile())
+		}
+		return err
+	}
+	return shutdown, nil
+}
+
+// start a span for every request, named by the pattern of the route that serves it
+// the trace is continued if the request carries a W3C traceparent header
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := newResponseRecorder(w)
+		r = r.WithContext(ctx)
+
+		// the span is finished even if the handler panics
+		defer func() {
+			if pattern := routePattern(r); pattern != "" {
+				span.SetName(pattern)
+				_, route, _ := strings.Cut(pattern, " ")
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// pgxTracer starts a span for every PostgreSQL query
+type pgxTracer struct{}
+
+func (pgxTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	// name the span by the SQL command, e.g. SELECT
+	operation, _, _ := strings.Cut(strings.TrimSpace(data.SQL), " ")
+	operation = strings.ToUpper(strings.TrimSpace(operation))
+
+	ctx, _ = tracer.Start(ctx, "postgresql "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(data.SQL),
+		),
+	)
+	return ctx
+}
+
+func (pgxTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+		return
+	}
+	span.SetAttributes(attribute.Int64("db.response.rows_affected", data.CommandTag.RowsAffected()))
+}
+
+// tracedSessionStore starts a span for every operation of the session store it wraps
+type tracedSessionStore struct {
+	scs.Store
+}
+
+// wrap the session store so that its operations are traced
+func newTracedSessionStore(store scs.Store) *tracedSessionStore {
+	return &tracedSessionStore{Store: store}
+}
+
+func (tss *tracedSessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	ctx, span := tracer.Start(ctx, "session find")
+	defer span.End()
+
+	var b []byte
+	var found bool
+	var err error
+	if cs, ok := tss.Store.(scs.CtxStore); ok {
+		b, found, err = cs.FindCtx(ctx, token)
+	} else {
+		b, found, err = tss.Store.Find(token)
+	}
+	recordSpanError(span, err)
+	span.SetAttributes(attribute.Bool("session.found", found))
+	return b, found, err
+}
+
+func (tss *tracedSessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	ctx, span := tracer.Start(ctx, "session commit")
+	defer span.End()
+
+	var err error
+	if cs, ok := tss.Store.(scs.CtxStore); ok {
+		err = cs.CommitCtx(ctx, token, b, expiry)
+	} else {
+		err = tss.Store.Commit(token, b, expiry)
+	}
+	recordSpanError(span, err)
+	return err
+}
+
+func (tss *tracedSessionStore) DeleteCtx(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "session delete")
+	defer span.End()
+
+	var err error
+	if cs, ok := tss.Store.(scs.CtxStore); ok {
+		err = cs.DeleteCtx(ctx, token)
+	} else {
+		err = tss.Store.Delete(token)
+	}
+	recordSpanError(span, err)
+	return err
+}
+
+// mark the span as failed if err isn't nil
+func recordSpanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// traceLogHandler adds the IDs of the current span to the records logged with a context
+type traceLogHandler struct {
+	slog.Handler
+}
+
+func (h traceLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceLogHandler) WithGroup(name string) slog.Handler {
+	return traceLogHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spanRecorderOnce sync.Once
+	spanRecorder     *tracetest.SpanRecorder
+)
+
+// install a global tracer provider recording every span
+// the provider is installed once since the tracer of the application only delegates to the first one
+func recordSpans() *tracetest.SpanRecorder {
+	spanRecorderOnce.Do(func() {
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	return spanRecorder
+}
+
+// return the names of the ended spans of the trace
+func spanNames(sr *tracetest.SpanRecorder, traceID trace.TraceID) []string {
+	var names []string
+	for _, span := range sr.Ended() {
+		if span.SpanContext().TraceID() == traceID {
+			names = append(names, span.Name())
+		}
+	}
+	return names
+}
+
+func TestTraceRequests(t *testing.T) {
+	sr := recordSpans()
+	app := newTestApplication(t)
+	ts := newTestServer(t, handler(app))
+
+	err := app.userModel.Insert(context.Background(), "Alice", "alice@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.snippetModel.Insert(context.Background(), "An old silent pond", "An old silent pond...", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.login(t, ts.Client(), "alice@example.com")
+
+	// continue a trace started by the client so that its spans can be told apart
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/snippet/view/%d", ts.URL, id), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID.String()+"-00f067aa0ba902b7-01")
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ := readResponse(t, res)
+	assert.Equal(t, code, http.StatusOK)
+
+	names := spanNames(sr, traceID)
+	tests := []string{
+		// the request span is named by route pattern, not by URI
+		"GET /snippet/view/{id}",
+		"render view.tmpl",
+		"session find",
+	}
+	for _, want := range tests {
+		if !slices.Contains(names, want) {
+			t.Errorf("spans %q don't contain %q", names, want)
+		}
+	}
+}
+
+func TestTraceLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(traceLogHandler{slog.NewJSONHandler(&buf, nil)})
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	logger.InfoContext(ctx, "with span")
+	logger.Info("without span")
+
+	dec := json.NewDecoder(&buf)
+	var withSpan, withoutSpan map[string]any
+	if err := dec.Decode(&withSpan); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&withoutSpan); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, withSpan["trace_id"], any(sc.TraceID().String()))
+	assert.Equal(t, withSpan["span_id"], any(sc.SpanID().String()))
+	assert.Equal(t, withoutSpan["trace_id"], nil)
+}
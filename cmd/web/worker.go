@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/obzva/snippetbox/internal/model"
+)
+
+// return a job that deletes the expired snippets of the store
+func purgeExpiredSnippets(logger *slog.Logger, snippets model.SnippetStore) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := snippets.DeleteExpired(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			logger.Info("deleted expired snippets", slog.Int("count", n))
+		}
+		return nil
+	}
+}
+
+// return a job that deletes the signed-in sessions whose session cookie has expired
+func purgeExpiredUserSessions(logger *slog.Logger, userSessions model.UserSessionStore) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := userSessions.DeleteExpired(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			logger.Info("deleted expired user sessions", slog.Int("count", n))
+		}
+		return nil
+	}
+}
+
+// return a job that deletes the buckets no policy needs anymore
+// a bucket left alone for the refill time of every policy is full, as good as a missing one
+func purgeIdleRateLimits(logger *slog.Logger, rateLimits model.RateLimitStore) func(ctx context.Context) error {
+	var idle time.Duration
+	for _, p := range rateLimitPolicies {
+		idle = max(idle, p.refillTime())
+	}
+
+	return func(ctx context.Context) error {
+		n, err := rateLimits.DeleteIdle(ctx, idle)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			logger.Info("deleted idle rate limit buckets", slog.Int("count", n))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+// Package migration applies the versioned database schema migrations embedded in the binary.
+//
+// A database whose tables were created before its migrations were recorded, e.g. by hand,
+// is refused by Up until it is adopted with Baseline at the version its schema matches.
+package migration
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migration files of each database are named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var (
+	ErrNoMigration = errors.New("migration: no migration to roll back")
+	// the tables were created before the migrations were recorded, e.g. by hand
+	ErrUnrecordedSchema = errors.New(`migration: the database has tables but no recorded migration, record the migrations its schema matches with "migrate baseline <version>" first`)
+	ErrAlreadyRecorded  = errors.New("migration: migrations are recorded already, only a database without recorded migrations can be baselined")
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of a migration in the database
+type Status struct {
+	Migration
+	// zero if the migration is not applied yet
+	Applied time.Time
+}
+
+// Migrator applies and rolls back the migrations of a database
+type Migrator interface {
+	// return the version of the latest embedded migration
+	Latest() int
+	// return the version of the latest applied migration, zero if none is applied
+	// it only reads and doesn't take the lock, so that it is cheap enough for readiness probes
+	Version(ctx context.Context) (int, error)
+	// apply every pending migration and return the applied ones
+	Up(ctx context.Context) ([]Migration, error)
+	// roll back the latest applied migration and return it
+	Down(ctx context.Context) (Migration, error)
+	// return the status of every embedded migration
+	Status(ctx context.Context) ([]Status, error)
+	// record the migrations up to version as applied without running them and return them
+	// it adopts a schema created before the migrations were recorded, ErrAlreadyRecorded if some are
+	Baseline(ctx context.Context, version int) ([]Migration, error)
+}
+
+var (
+	_ Migrator = (*PostgresMigrator)(nil)
+	_ Migrator = (*SQLiteMigrator)(nil)
+)
+
+// load the embedded migrations in the directory dir ordered by version
+func load(dir string) ([]Migration, error) {
+	paths, err := fs.Glob(files, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, p := range paths {
+		base := path.Base(p)
+
+		versionName, ok := strings.CutSuffix(base, ".sql")
+		if !ok {
+			continue
+		}
+		versionName, direction, _ := cutLast(versionName, ".")
+		v, name, ok := strings.Cut(versionName, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration: invalid file name %q", base)
+		}
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("migration: invalid file name %q", base)
+		}
+
+		b, err := fs.ReadFile(files, p)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		switch direction {
+		case "up":
+			m.Up = string(b)
+		case "down":
+			m.Down = string(b)
+		default:
+			return nil, fmt.Errorf("migration: invalid file name %q", base)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration: version %d needs both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	return migrations, nil
+}
+
+// find the migration with this version among the migrations
+func find(migrations []Migration, version int) (Migration, error) {
+	i := slices.IndexFunc(migrations, func(mig Migration) bool {
+		return mig.Version == version
+	})
+	if i < 0 {
+		return Migration{}, fmt.Errorf("migration: version %d is applied but unknown", version)
+	}
+	return migrations[i], nil
+}
+
+// return the migrations up to version, which must be the version of one of them
+func upTo(migrations []Migration, version int) ([]Migration, error) {
+	if _, err := find(migrations, version); err != nil {
+		return nil, fmt.Errorf("migration: version %d is unknown", version)
+	}
+
+	i := slices.IndexFunc(migrations, func(mig Migration) bool {
+		return mig.Version > version
+	})
+	if i < 0 {
+		return migrations, nil
+	}
+	return migrations[:i], nil
+}
+
+// return the version of the latest migration
+func latest(migrations []Migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,30 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+func TestLoad(t *testing.T) {
+	postgres, err := load("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := load("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// versions start at 1 without gaps
+	for i, m := range postgres {
+		assert.Equal(t, m.Version, i+1)
+	}
+
+	// both databases share the same migration history
+	assert.Equal(t, len(sqlite), len(postgres))
+	for i := range sqlite {
+		assert.Equal(t, sqlite[i].Version, postgres[i].Version)
+		assert.Equal(t, sqlite[i].Name, postgres[i].Name)
+	}
+}
@@ -0,0 +1,243 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey identifies the advisory lock that keeps concurrent migrators from running at the same time
+const lockKey = 7461_2031
+
+// PostgresMigrator applies and rolls back migrations of a PostgreSQL database
+// and records them in the schema_migration table
+type PostgresMigrator struct {
+	DBPool     *pgxpool.Pool
+	Migrations []Migration
+}
+
+func NewPostgresMigrator(dbPool *pgxpool.Pool) (*PostgresMigrator, error) {
+	migrations, err := load("postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &PostgresMigrator{
+		DBPool:     dbPool,
+		Migrations: migrations,
+	}
+	return m, nil
+}
+
+// return the version of the latest embedded migration
+func (m *PostgresMigrator) Latest() int {
+	return latest(m.Migrations)
+}
+
+// return the version of the latest applied migration, zero if none is applied
+// it only reads and doesn't take the lock, so that it is cheap enough for readiness probes
+func (m *PostgresMigrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.DBPool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migration`).Scan(&version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" { // postgresql error code: undefined_table
+			// no migrator has run yet
+			return 0, nil
+		}
+		return 0, err
+	}
+	return version, nil
+}
+
+// apply every pending migration and return the applied ones
+func (m *PostgresMigrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := currentPostgresVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			if err := checkNoPostgresTables(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		for _, mig := range m.Migrations {
+			if mig.Version <= version {
+				continue
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				stmt := `INSERT INTO schema_migration (version, name, applied)
+				VALUES($1, $2, CURRENT_TIMESTAMP)`
+				_, err := tx.Exec(ctx, stmt, mig.Version, mig.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration: %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			applied = append(applied, mig)
+		}
+
+		return nil
+	})
+	return applied, err
+}
+
+// roll back the latest applied migration and return it
+func (m *PostgresMigrator) Down(ctx context.Context) (Migration, error) {
+	var rolledBack Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := currentPostgresVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return ErrNoMigration
+		}
+
+		mig, err := find(m.Migrations, version)
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, mig.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `DELETE FROM schema_migration WHERE version = $1`, mig.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration: %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+
+		rolledBack = mig
+		return nil
+	})
+	return rolledBack, err
+}
+
+// return the status of every embedded migration
+func (m *PostgresMigrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		rows, err := conn.Query(ctx, `SELECT version, applied FROM schema_migration`)
+		if err != nil {
+			return err
+		}
+
+		applied := make(map[int]time.Time)
+		var version int
+		var at time.Time
+		_, err = pgx.ForEachRow(rows, []any{&version, &at}, func() error {
+			applied[version] = at
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.Migrations {
+			statuses = append(statuses, Status{Migration: mig, Applied: applied[mig.Version]})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// record the migrations up to version as applied without running them and return them
+func (m *PostgresMigrator) Baseline(ctx context.Context, version int) ([]Migration, error) {
+	migrations, err := upTo(m.Migrations, version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		current, err := currentPostgresVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current != 0 {
+			return ErrAlreadyRecorded
+		}
+
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			for _, mig := range migrations {
+				stmt := `INSERT INTO schema_migration (version, name, applied)
+				VALUES($1, $2, CURRENT_TIMESTAMP)`
+				if _, err := tx.Exec(ctx, stmt, mig.Version, mig.Name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// run fn on a single connection while holding the advisory lock
+// the schema_migration table is created if it doesn't exist
+func (m *PostgresMigrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.DBPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migration (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied TIMESTAMPTZ NOT NULL
+	)`
+	if _, err := conn.Exec(ctx, stmt); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func currentPostgresVersion(ctx context.Context, conn *pgxpool.Conn) (int, error) {
+	var version int
+	err := conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migration`).Scan(&version)
+	return version, err
+}
+
+// return ErrUnrecordedSchema if the current schema has tables other than schema_migration
+func checkNoPostgresTables(ctx context.Context, conn *pgxpool.Conn) error {
+	stmt := `SELECT EXISTS (
+		SELECT 1
+		FROM information_schema.tables
+		WHERE
+			table_schema = current_schema()
+			AND table_name <> 'schema_migration'
+	)`
+
+	var exists bool
+	if err := conn.QueryRow(ctx, stmt).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrUnrecordedSchema
+	}
+	return nil
+}
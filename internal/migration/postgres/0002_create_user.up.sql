@@ -0,0 +1,8 @@
+CREATE TABLE "user" (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    hashed_password BYTEA NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    CONSTRAINT user_uc_email UNIQUE (email)
+);
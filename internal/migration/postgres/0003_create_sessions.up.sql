@@ -0,0 +1,8 @@
+-- session data of scs, see https://github.com/alexedwards/scs/tree/master/pgxstore
+CREATE TABLE sessions (
+    token TEXT PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
@@ -0,0 +1,10 @@
+CREATE TABLE user_session (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX user_session_user_id_idx ON user_session (user_id);
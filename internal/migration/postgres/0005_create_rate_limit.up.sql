@@ -0,0 +1,7 @@
+CREATE TABLE rate_limit (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_updated_idx ON rate_limit (updated);
@@ -0,0 +1,8 @@
+ALTER TABLE user_session ADD COLUMN expires TIMESTAMPTZ;
+
+-- the expiry of the sessions signed in before is unknown, so they get the default "remember me" lifetime
+UPDATE user_session SET expires = created + INTERVAL '30 days';
+
+ALTER TABLE user_session ALTER COLUMN expires SET NOT NULL;
+
+CREATE INDEX user_session_expires_idx ON user_session (expires);
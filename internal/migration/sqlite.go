@@ -0,0 +1,254 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLiteMigrator applies and rolls back migrations of a SQLite database
+// and records them in the schema_migration table
+type SQLiteMigrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+func NewSQLiteMigrator(db *sql.DB) (*SQLiteMigrator, error) {
+	migrations, err := load("sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SQLiteMigrator{
+		DB:         db,
+		Migrations: migrations,
+	}
+	return m, nil
+}
+
+// return the version of the latest embedded migration
+func (m *SQLiteMigrator) Latest() int {
+	return latest(m.Migrations)
+}
+
+// return the version of the latest applied migration, zero if none is applied
+// it only reads and doesn't take the lock, so that it is cheap enough for readiness probes
+func (m *SQLiteMigrator) Version(ctx context.Context) (int, error) {
+	stmt := `SELECT EXISTS (
+		SELECT 1
+		FROM sqlite_master
+		WHERE
+			type = 'table'
+			AND name = 'schema_migration'
+	)`
+
+	var exists bool
+	if err := m.DB.QueryRowContext(ctx, stmt).Scan(&exists); err != nil {
+		return 0, err
+	}
+	// no migrator has run yet
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err := m.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migration`).Scan(&version)
+	return version, err
+}
+
+// apply every pending migration and return the applied ones
+func (m *SQLiteMigrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	for {
+		var next *Migration
+		err := m.withLock(ctx, func(conn *sql.Conn) error {
+			version, err := currentSQLiteVersion(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if version == 0 {
+				if err := checkNoSQLiteTables(ctx, conn); err != nil {
+					return err
+				}
+			}
+
+			for _, mig := range m.Migrations {
+				if mig.Version > version {
+					next = &mig
+					break
+				}
+			}
+			if next == nil {
+				return nil
+			}
+
+			if _, err := conn.ExecContext(ctx, next.Up); err != nil {
+				return fmt.Errorf("migration: %04d_%s: %w", next.Version, next.Name, err)
+			}
+			stmt := `INSERT INTO schema_migration (version, name, applied)
+			VALUES(?, ?, ?)`
+			_, err = conn.ExecContext(ctx, stmt, next.Version, next.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return applied, err
+		}
+		if next == nil {
+			return applied, nil
+		}
+
+		applied = append(applied, *next)
+	}
+}
+
+// roll back the latest applied migration and return it
+func (m *SQLiteMigrator) Down(ctx context.Context) (Migration, error) {
+	var rolledBack Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		version, err := currentSQLiteVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return ErrNoMigration
+		}
+
+		mig, err := find(m.Migrations, version)
+		if err != nil {
+			return err
+		}
+
+		if _, err := conn.ExecContext(ctx, mig.Down); err != nil {
+			return fmt.Errorf("migration: %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migration WHERE version = ?`, mig.Version); err != nil {
+			return err
+		}
+
+		rolledBack = mig
+		return nil
+	})
+	return rolledBack, err
+}
+
+// return the status of every embedded migration
+func (m *SQLiteMigrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(ctx, `SELECT version, applied FROM schema_migration`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		applied := make(map[int]time.Time)
+		for rows.Next() {
+			var version int
+			var at time.Time
+			if err := rows.Scan(&version, &at); err != nil {
+				return err
+			}
+			applied[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, mig := range m.Migrations {
+			statuses = append(statuses, Status{Migration: mig, Applied: applied[mig.Version]})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// record the migrations up to version as applied without running them and return them
+func (m *SQLiteMigrator) Baseline(ctx context.Context, version int) ([]Migration, error) {
+	migrations, err := upTo(m.Migrations, version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := currentSQLiteVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current != 0 {
+			return ErrAlreadyRecorded
+		}
+
+		for _, mig := range migrations {
+			stmt := `INSERT INTO schema_migration (version, name, applied)
+			VALUES(?, ?, ?)`
+			if _, err := conn.ExecContext(ctx, stmt, mig.Version, mig.Name, time.Now().UTC()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// run fn in an immediate transaction, which keeps other writers out of the database until it ends
+// the schema_migration table is created if it doesn't exist
+func (m *SQLiteMigrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			conn.ExecContext(context.WithoutCancel(ctx), `ROLLBACK`)
+			return
+		}
+		_, err = conn.ExecContext(ctx, `COMMIT`)
+	}()
+
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migration (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied DATETIME NOT NULL
+	)`
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func currentSQLiteVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migration`).Scan(&version)
+	return version, err
+}
+
+// return ErrUnrecordedSchema if the database has tables other than schema_migration
+func checkNoSQLiteTables(ctx context.Context, conn *sql.Conn) error {
+	stmt := `SELECT EXISTS (
+		SELECT 1
+		FROM sqlite_master
+		WHERE
+			type = 'table'
+			AND name <> 'schema_migration'
+			AND name NOT LIKE 'sqlite_%'
+	)`
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, stmt).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrUnrecordedSchema
+	}
+	return nil
+}
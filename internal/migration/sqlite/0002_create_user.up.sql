@@ -0,0 +1,8 @@
+CREATE TABLE user (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    hashed_password BLOB NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT user_uc_email UNIQUE (email)
+);
@@ -0,0 +1,8 @@
+-- session data of scs, see https://github.com/alexedwards/scs/tree/master/sqlite3store
+CREATE TABLE sessions (
+    token TEXT PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry REAL NOT NULL
+);
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
@@ -0,0 +1,7 @@
+CREATE TABLE rate_limit (
+    key TEXT PRIMARY KEY,
+    tokens REAL NOT NULL,
+    updated DATETIME NOT NULL
+);
+
+CREATE INDEX rate_limit_updated_idx ON rate_limit (updated);
@@ -0,0 +1,3 @@
+DROP INDEX user_session_expires_idx;
+
+ALTER TABLE user_session DROP COLUMN expires;
@@ -0,0 +1,6 @@
+ALTER TABLE user_session ADD COLUMN expires DATETIME NOT NULL DEFAULT '';
+
+-- the expiry of the sessions signed in before is unknown, so they get the default "remember me" lifetime
+UPDATE user_session SET expires = strftime('%Y-%m-%d %H:%M:%f+00:00', created, '+30 days');
+
+CREATE INDEX user_session_expires_idx ON user_session (expires);
@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newTestSQLiteMigrator(t *testing.T) *SQLiteMigrator {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "snippetbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewSQLiteMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSQLiteMigratorBaseline(t *testing.T) {
+	ctx := context.Background()
+	m := newTestSQLiteMigrator(t)
+
+	// a schema created by hand before the migrations were recorded
+	for _, mig := range m.Migrations[:3] {
+		if _, err := m.DB.ExecContext(ctx, mig.Up); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := m.Up(ctx)
+	assert.Equal(t, errors.Is(err, ErrUnrecordedSchema), true)
+
+	_, err = m.Baseline(ctx, m.Latest()+1)
+	assert.Equal(t, err != nil, true)
+
+	recorded, err := m.Baseline(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(recorded), 3)
+
+	_, err = m.Baseline(ctx, 3)
+	assert.Equal(t, errors.Is(err, ErrAlreadyRecorded), true)
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(applied), len(m.Migrations)-3)
+	assert.Equal(t, applied[0].Version, 4)
+
+	version, err := m.Version(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, version, m.Latest())
+}
+
+func TestSQLiteMigratorUpEmpty(t *testing.T) {
+	ctx := context.Background()
+	m := newTestSQLiteMigrator(t)
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(applied), len(m.Migrations))
+
+	// nothing is left to apply, though the database has tables now
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(applied), 0)
+}
@@ -0,0 +1,357 @@
+package model
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	_ SnippetStore     = (*MemorySnippetStore)(nil)
+	_ UserStore        = (*MemoryUserStore)(nil)
+	_ UserSessionStore = (*MemoryUserSessionStore)(nil)
+	_ RateLimitStore   = (*MemoryRateLimitStore)(nil)
+)
+
+// MemorySnippetStore is a SnippetStore that keeps snippets in memory
+// it is safe for concurrent use
+type MemorySnippetStore struct {
+	mu       sync.RWMutex
+	snippets []Snippet
+	// id of the last inserted snippet
+	lastID int
+}
+
+func NewMemorySnippetStore() *MemorySnippetStore {
+	return &MemorySnippetStore{}
+}
+
+func (mss *MemorySnippetStore) Insert(ctx context.Context, title string, content string, expires int) (int, error) {
+	mss.mu.Lock()
+	defer mss.mu.Unlock()
+
+	mss.lastID++
+	now := time.Now().UTC()
+	s := Snippet{
+		ID:      mss.lastID,
+		Title:   title,
+		Content: content,
+		Created: now,
+		Expires: now.AddDate(0, 0, expires),
+	}
+	mss.snippets = append(mss.snippets, s)
+
+	return s.ID, nil
+}
+
+func (mss *MemorySnippetStore) Get(ctx context.Context, id int) (Snippet, error) {
+	mss.mu.RLock()
+	defer mss.mu.RUnlock()
+
+	i := slices.IndexFunc(mss.snippets, func(s Snippet) bool {
+		return s.ID == id
+	})
+	if i < 0 {
+		return Snippet{}, ErrNoRecord
+	}
+
+	s := mss.snippets[i]
+	if !s.Expires.After(time.Now()) {
+		return Snippet{}, ErrNoRecord
+	}
+
+	return s, nil
+}
+
+func (mss *MemorySnippetStore) Latest(ctx context.Context) ([]Snippet, error) {
+	mss.mu.RLock()
+	defer mss.mu.RUnlock()
+
+	now := time.Now()
+	var s []Snippet
+	for _, snippet := range mss.snippets {
+		if snippet.Expires.After(now) {
+			s = append(s, snippet)
+		}
+	}
+
+	slices.SortFunc(s, func(a, b Snippet) int {
+		return cmp.Or(b.Created.Compare(a.Created), b.ID-a.ID)
+	})
+
+	return s[:min(len(s), 10)], nil
+}
+
+func (mss *MemorySnippetStore) DeleteExpired(ctx context.Context) (int, error) {
+	mss.mu.Lock()
+	defer mss.mu.Unlock()
+
+	now := time.Now()
+	n := len(mss.snippets)
+	mss.snippets = slices.DeleteFunc(mss.snippets, func(s Snippet) bool {
+		return !s.Expires.After(now)
+	})
+
+	return n - len(mss.snippets), nil
+}
+
+// MemoryUserStore is a UserStore that keeps users in memory
+// it is safe for concurrent use
+type MemoryUserStore struct {
+	// parameters for hashing new passwords
+	PasswordParams Argon2idParams
+
+	mu    sync.RWMutex
+	users []User
+}
+
+func NewMemoryUserStore(params Argon2idParams) *MemoryUserStore {
+	return &MemoryUserStore{PasswordParams: params}
+}
+
+func (mus *MemoryUserStore) Insert(ctx context.Context, name, email, password string) error {
+	hashedPW, err := hashPassword(password, mus.PasswordParams)
+	if err != nil {
+		return err
+	}
+
+	_, err = mus.insert(name, email, hashedPW)
+	return err
+}
+
+func (mus *MemoryUserStore) InsertWithoutPassword(ctx context.Context, name, email string) (int, error) {
+	return mus.insert(name, email, []byte{})
+}
+
+func (mus *MemoryUserStore) insert(name, email string, hashedPW []byte) (int, error) {
+	mus.mu.Lock()
+	defer mus.mu.Unlock()
+
+	if slices.ContainsFunc(mus.users, func(u User) bool { return u.Email == email }) {
+		return 0, ErrDuplicateEmail
+	}
+
+	u := User{
+		ID:             len(mus.users) + 1,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPW,
+		Created:        time.Now().UTC(),
+	}
+	mus.users = append(mus.users, u)
+
+	return u.ID, nil
+}
+
+func (mus *MemoryUserStore) Authenticate(ctx context.Context, email, password string) (int, error) {
+	mus.mu.RLock()
+	i := slices.IndexFunc(mus.users, func(u User) bool { return u.Email == email })
+	var u User
+	if i >= 0 {
+		u = mus.users[i]
+	}
+	mus.mu.RUnlock()
+
+	if i < 0 {
+		return 0, ErrInvalidCredentials
+	}
+
+	newHash, err := checkPassword(password, u.HashedPassword, mus.PasswordParams)
+	if err != nil {
+		return 0, err
+	}
+
+	if newHash != nil {
+		mus.mu.Lock()
+		mus.users[i].HashedPassword = newHash
+		mus.mu.Unlock()
+	}
+
+	return u.ID, nil
+}
+
+func (mus *MemoryUserStore) Check(ctx context.Context, id int) (bool, error) {
+	mus.mu.RLock()
+	defer mus.mu.RUnlock()
+
+	return id >= 1 && id <= len(mus.users), nil
+}
+
+func (mus *MemoryUserStore) IDByEmail(ctx context.Context, email string) (int, error) {
+	mus.mu.RLock()
+	defer mus.mu.RUnlock()
+
+	i := slices.IndexFunc(mus.users, func(u User) bool { return u.Email == email })
+	if i < 0 {
+		return 0, ErrNoRecord
+	}
+
+	return mus.users[i].ID, nil
+}
+
+// MemoryUserSessionStore is a UserSessionStore that keeps signed-in sessions in memory
+// it is safe for concurrent use
+type MemoryUserSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]UserSession
+}
+
+func NewMemoryUserSessionStore() *MemoryUserSessionStore {
+	return &MemoryUserSessionStore{sessions: make(map[string]UserSession)}
+}
+
+func (muss *MemoryUserSessionStore) Insert(ctx context.Context, userID int, userAgent, ip string, expires time.Time) (string, error) {
+	muss.mu.Lock()
+	defer muss.mu.Unlock()
+
+	now := time.Now().UTC()
+	s := UserSession{
+		ID:        rand.Text(),
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        ip,
+		Created:   now,
+		LastSeen:  now,
+		Expires:   expires.UTC(),
+	}
+	muss.sessions[s.ID] = s
+
+	return s.ID, nil
+}
+
+func (muss *MemoryUserSessionStore) Touch(ctx context.Context, id string, userID int) (time.Time, error) {
+	muss.mu.Lock()
+	defer muss.mu.Unlock()
+
+	s, ok := muss.sessions[id]
+	if !ok || s.UserID != userID || !s.Expires.After(time.Now()) {
+		return time.Time{}, ErrNoRecord
+	}
+
+	lastSeen := s.LastSeen
+	s.LastSeen = time.Now().UTC()
+	muss.sessions[id] = s
+
+	return lastSeen, nil
+}
+
+func (muss *MemoryUserSessionStore) List(ctx context.Context, userID int) ([]UserSession, error) {
+	muss.mu.Lock()
+	defer muss.mu.Unlock()
+
+	now := time.Now()
+	var s []UserSession
+	for _, session := range muss.sessions {
+		if session.UserID == userID && session.Expires.After(now) {
+			s = append(s, session)
+		}
+	}
+
+	slices.SortFunc(s, func(a, b UserSession) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+
+	return s, nil
+}
+
+func (muss *MemoryUserSessionStore) Revoke(ctx context.Context, id string, userID int) error {
+	muss.mu.Lock()
+	defer muss.mu.Unlock()
+
+	if s, ok := muss.sessions[id]; ok && s.UserID == userID {
+		delete(muss.sessions, id)
+	}
+
+	return nil
+}
+
+func (muss *MemoryUserSessionStore) RevokeOthers(ctx context.Context, id string, userID int) error {
+	muss.mu.Lock()
+	defer muss.mu.Unlock()
+
+	for sid, s := range muss.sessions {
+		if sid != id && s.UserID == userID {
+			delete(muss.sessions, sid)
+		}
+	}
+
+	return nil
+}
+
+func (muss *MemoryUserSessionStore) Count(ctx context.Context) (int, error) {
+	muss.mu.Lock()
+	defer muss.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, s := range muss.sessions {
+		if s.Expires.After(now) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (muss *MemoryUserSessionStore) DeleteExpired(ctx context.Context) (int, error) {
+	muss.mu.Lock()
+	defer muss.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for id, s := range muss.sessions {
+		if !s.Expires.After(now) {
+			delete(muss.sessions, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps the token buckets in memory
+// it is safe for concurrent use
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]tokenBucket
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]tokenBucket)}
+}
+
+func (mrls *MemoryRateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	mrls.mu.Lock()
+	defer mrls.mu.Unlock()
+
+	b, found := mrls.buckets[key]
+	if !found {
+		b.tokens = float64(burst)
+	}
+
+	now := time.Now().UTC()
+	ok, retryAfter := b.take(now, rate, burst)
+	b.updated = now
+	mrls.buckets[key] = b
+
+	return ok, retryAfter, nil
+}
+
+func (mrls *MemoryRateLimitStore) DeleteIdle(ctx context.Context, idle time.Duration) (int, error) {
+	mrls.mu.Lock()
+	defer mrls.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-idle)
+	n := 0
+	for key, b := range mrls.buckets {
+		if !b.updated.After(cutoff) {
+			delete(mrls.buckets, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errInvalidHash = errors.New("model: invalid password hash")
+
+// Argon2idParams holds the parameters used to hash passwords with argon2id
+type Argon2idParams struct {
+	// memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the recommendation of RFC 9106
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// hash the password with argon2id and encode it in the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func hashPassword(password string, p Argon2idParams) ([]byte, error) {
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+// check the password of a user against their stored hash for Authenticate
+// ErrInvalidCredentials is returned if it doesn't match
+// newHash is the password hashed with the params p if the stored hash should be upgraded to the current algorithm
+// and parameters, nil otherwise, so that every store only has to save it
+func checkPassword(password string, hash []byte, p Argon2idParams) (newHash []byte, err error) {
+	match, rehash, err := verifyPassword(password, hash, p)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrInvalidCredentials
+	}
+	if !rehash {
+		return nil, nil
+	}
+
+	return hashPassword(password, p)
+}
+
+// check if the password matches the hash, which is either an encoded argon2id hash or a bcrypt hash
+// rehash is true if the hash should be replaced with a new one hashed with the params p
+func verifyPassword(password string, hash []byte, p Argon2idParams) (match, rehash bool, err error) {
+	// users who sign in through single sign-on have no password
+	if len(hash) == 0 {
+		return false, false, nil
+	}
+
+	if !bytes.HasPrefix(hash, []byte("$argon2id$")) {
+		// every hash stored before argon2id was introduced is a bcrypt hash
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	hp, salt, key, err := decodeArgon2idHash(string(hash))
+	if err != nil {
+		return false, false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, hp.Iterations, hp.Memory, hp.Parallelism, hp.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, hp != p, nil
+}
+
+// decode the PHC string of an argon2id hash into its params, salt and key
+func decodeArgon2idHash(hash string) (Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=4", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Argon2idParams{}, nil, nil, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2idParams{}, nil, nil, errInvalidHash
+	}
+	if version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("model: unsupported argon2 version %d", version)
+	}
+
+	var p Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, errInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, errInvalidHash
+	}
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestVerifyPassword(t *testing.T) {
+	argon2idHash, err := hashPassword("correct horse battery staple", testArgon2idParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakerParams := testArgon2idParams
+	weakerParams.Iterations = 2
+	outdatedHash, err := hashPassword("correct horse battery staple", weakerParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		hash       []byte
+		wantMatch  bool
+		wantRehash bool
+	}{
+		{
+			name:       "Argon2id",
+			password:   "correct horse battery staple",
+			hash:       argon2idHash,
+			wantMatch:  true,
+			wantRehash: false,
+		},
+		{
+			name:       "Argon2id mismatch",
+			password:   "incorrect horse battery staple",
+			hash:       argon2idHash,
+			wantMatch:  false,
+			wantRehash: false,
+		},
+		{
+			name:       "Argon2id outdated params",
+			password:   "correct horse battery staple",
+			hash:       outdatedHash,
+			wantMatch:  true,
+			wantRehash: true,
+		},
+		{
+			name:       "Bcrypt",
+			password:   "correct horse battery staple",
+			hash:       bcryptHash,
+			wantMatch:  true,
+			wantRehash: true,
+		},
+		{
+			name:       "Bcrypt mismatch",
+			password:   "incorrect horse battery staple",
+			hash:       bcryptHash,
+			wantMatch:  false,
+			wantRehash: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := verifyPassword(tt.password, tt.hash, testArgon2idParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, match, tt.wantMatch)
+			assert.Equal(t, rehash, tt.wantRehash)
+		})
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a match with an outdated hash comes with a current one
+	newHash, err := checkPassword("correct horse battery staple", bcryptHash, testArgon2idParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, rehash, err := verifyPassword("correct horse battery staple", newHash, testArgon2idParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, match, true)
+	assert.Equal(t, rehash, false)
+
+	// a match with a current hash keeps it
+	newHash, err = checkPassword("correct horse battery staple", newHash, testArgon2idParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, newHash == nil, true)
+
+	_, err = checkPassword("incorrect horse battery staple", bcryptHash, testArgon2idParams)
+	assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+}
+
+func TestVerifyPasswordLongPassphrase(t *testing.T) {
+	// bcrypt only uses the first 72 bytes of a password
+	prefix := string(make([]byte, 72))
+
+	hash, err := hashPassword(prefix+"a", testArgon2idParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, _, err := verifyPassword(prefix+"b", hash, testArgon2idParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, match, false)
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tokenBucket holds the tokens left for a rate limit key
+type tokenBucket struct {
+	tokens float64
+	// when the tokens were last counted, zero for a new bucket
+	updated time.Time
+}
+
+// add the tokens gained since the bucket was last updated and take one if there is any
+// return whether a token was taken and, if not, how long until the next one is added
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	if !b.updated.IsZero() {
+		if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+			b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		}
+	}
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+type RateLimitModel struct {
+	DBPool *pgxpool.Pool
+}
+
+// take a token from the bucket with this key
+// the row of the bucket is locked so that concurrent requests of every instance take turns
+func (rlm *RateLimitModel) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	tx, err := rlm.DBPool.Begin(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the clock of the database is shared by every instance
+	// clock_timestamp() is read after the row lock is taken, CURRENT_TIMESTAMP is the start of the transaction
+	// and could be earlier than the update of the transaction we waited for
+	stmt := `INSERT INTO rate_limit (key, tokens, updated)
+	VALUES($1, $2, clock_timestamp())
+	ON CONFLICT (key) DO NOTHING`
+
+	if _, err := tx.Exec(ctx, stmt, key, float64(burst)); err != nil {
+		return false, 0, err
+	}
+
+	stmt = `SELECT tokens, updated, clock_timestamp()
+	FROM rate_limit
+	WHERE key = $1
+	FOR UPDATE`
+
+	var b tokenBucket
+	var now time.Time
+	if err := tx.QueryRow(ctx, stmt, key).Scan(&b.tokens, &b.updated, &now); err != nil {
+		return false, 0, err
+	}
+
+	ok, retryAfter := b.take(now, rate, burst)
+
+	stmt = `UPDATE rate_limit
+	SET tokens = $2, updated = $3
+	WHERE key = $1`
+
+	if _, err := tx.Exec(ctx, stmt, key, b.tokens, now); err != nil {
+		return false, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, 0, err
+	}
+
+	return ok, retryAfter, nil
+}
+
+// delete the buckets that haven't been used for the idle duration
+func (rlm *RateLimitModel) DeleteIdle(ctx context.Context, idle time.Duration) (int, error) {
+	stmt := `DELETE FROM rate_limit
+	WHERE updated <= CURRENT_TIMESTAMP - make_interval(secs => $1)`
+
+	tag, err := rlm.DBPool.Exec(ctx, stmt, idle.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
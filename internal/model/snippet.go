@@ -2,7 +2,6 @@ package model
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"time"
 
@@ -49,7 +48,7 @@ func (sm *SnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
 
 	s, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[Snippet])
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return Snippet{}, ErrNoRecord
 		} else {
 			return Snippet{}, err
@@ -79,3 +78,15 @@ func (sm *SnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
 
 	return s, nil
 }
+
+func (sm *SnippetModel) DeleteExpired(ctx context.Context) (int, error) {
+	stmt := `DELETE FROM snippet
+	WHERE expires <= CURRENT_TIMESTAMP`
+
+	tag, err := sm.DBPool.Exec(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
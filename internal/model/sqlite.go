@@ -0,0 +1,431 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	_ SnippetStore     = (*SQLiteSnippetModel)(nil)
+	_ UserStore        = (*SQLiteUserModel)(nil)
+	_ UserSessionStore = (*SQLiteUserSessionModel)(nil)
+	_ RateLimitStore   = (*SQLiteRateLimitModel)(nil)
+)
+
+// open the SQLite database file at path, creating it if it doesn't exist
+func OpenSQLite(path string) (*sql.DB, error) {
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	// "2006-01-02 15:04:05.999999999-07:00", which SQLite date and time functions understand
+	q.Add("_time_format", "sqlite")
+	// transactions take the write lock up front instead of failing to upgrade a read lock
+	q.Add("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// check if err is a violation of a unique constraint
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// timestamps are stored as text in UTC so that they compare in chronological order
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+type SQLiteSnippetModel struct {
+	DB *sql.DB
+}
+
+func (sm *SQLiteSnippetModel) Insert(ctx context.Context, title string, content string, expires int) (int, error) {
+	stmt := `INSERT INTO snippet (title, content, created, expires)
+	VALUES(?, ?, ?, ?)`
+
+	now := sqliteNow()
+	res, err := sm.DB.ExecContext(ctx, stmt, title, content, now, now.AddDate(0, 0, expires))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (sm *SQLiteSnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires
+	FROM snippet
+	WHERE
+		expires > ?
+		AND id = ?`
+
+	var s Snippet
+	err := sm.DB.QueryRowContext(ctx, stmt, sqliteNow(), id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		}
+		return Snippet{}, err
+	}
+
+	return s, nil
+}
+
+// return the 10 most recently created snippets
+func (sm *SQLiteSnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires
+	FROM snippet
+	WHERE expires > ?
+	ORDER BY created DESC, id DESC
+	LIMIT 10`
+
+	rows, err := sm.DB.QueryContext(ctx, stmt, sqliteNow())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+	for rows.Next() {
+		var s Snippet
+		if err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires); err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+func (sm *SQLiteSnippetModel) DeleteExpired(ctx context.Context) (int, error) {
+	stmt := `DELETE FROM snippet
+	WHERE expires <= ?`
+
+	res, err := sm.DB.ExecContext(ctx, stmt, sqliteNow())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+type SQLiteUserModel struct {
+	DB *sql.DB
+	// parameters for hashing new passwords
+	PasswordParams Argon2idParams
+}
+
+func (um *SQLiteUserModel) Insert(ctx context.Context, name, email, password string) error {
+	hashedPW, err := hashPassword(password, um.PasswordParams)
+	if err != nil {
+		return err
+	}
+
+	_, err = um.insert(ctx, name, email, hashedPW)
+	return err
+}
+
+func (um *SQLiteUserModel) InsertWithoutPassword(ctx context.Context, name, email string) (int, error) {
+	return um.insert(ctx, name, email, []byte{})
+}
+
+func (um *SQLiteUserModel) insert(ctx context.Context, name, email string, hashedPW []byte) (int, error) {
+	stmt := `INSERT INTO user (name, email, hashed_password, created)
+	VALUES(?, ?, ?, ?)`
+
+	res, err := um.DB.ExecContext(ctx, stmt, name, email, hashedPW, sqliteNow())
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return 0, ErrDuplicateEmail
+		}
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (um *SQLiteUserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	stmt := `SELECT id, hashed_password
+	FROM user
+	WHERE email = ?`
+
+	var id int
+	var hashedPW []byte
+	if err := um.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPW); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	newHash, err := checkPassword(password, hashedPW, um.PasswordParams)
+	if err != nil {
+		return 0, err
+	}
+
+	if newHash != nil {
+		stmt := `UPDATE user
+		SET hashed_password = ?
+		WHERE id = ?`
+
+		if _, err := um.DB.ExecContext(ctx, stmt, newHash, id); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// check if user with this id exists
+func (um *SQLiteUserModel) Check(ctx context.Context, id int) (bool, error) {
+	var ok bool
+
+	stmt := `SELECT EXISTS(
+	SELECT id
+	FROM user
+	WHERE id = ?
+	)`
+
+	if err := um.DB.QueryRowContext(ctx, stmt, id).Scan(&ok); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+func (um *SQLiteUserModel) IDByEmail(ctx context.Context, email string) (int, error) {
+	stmt := `SELECT id
+	FROM user
+	WHERE email = ?`
+
+	var id int
+	if err := um.DB.QueryRowContext(ctx, stmt, email).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+type SQLiteUserSessionModel struct {
+	DB *sql.DB
+}
+
+func (usm *SQLiteUserSessionModel) Insert(ctx context.Context, userID int, userAgent, ip string, expires time.Time) (string, error) {
+	stmt := `INSERT INTO user_session (id, user_id, user_agent, ip, created, last_seen, expires)
+	VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	id := rand.Text()
+	now := sqliteNow()
+	if _, err := usm.DB.ExecContext(ctx, stmt, id, userID, userAgent, ip, now, now, expires.UTC()); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (usm *SQLiteUserSessionModel) Touch(ctx context.Context, id string, userID int) (time.Time, error) {
+	tx, err := usm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT last_seen
+	FROM user_session
+	WHERE
+		id = ?
+		AND user_id = ?
+		AND expires > ?`
+
+	var lastSeen time.Time
+	if err := tx.QueryRowContext(ctx, stmt, id, userID, sqliteNow()).Scan(&lastSeen); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrNoRecord
+		}
+		return time.Time{}, err
+	}
+
+	stmt = `UPDATE user_session
+	SET last_seen = ?
+	WHERE id = ?`
+
+	if _, err := tx.ExecContext(ctx, stmt, sqliteNow(), id); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+
+	return lastSeen, nil
+}
+
+func (usm *SQLiteUserSessionModel) List(ctx context.Context, userID int) ([]UserSession, error) {
+	stmt := `SELECT id, user_id, user_agent, ip, created, last_seen, expires
+	FROM user_session
+	WHERE
+		user_id = ?
+		AND expires > ?
+	ORDER BY last_seen DESC`
+
+	rows, err := usm.DB.QueryContext(ctx, stmt, userID, sqliteNow())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []UserSession
+	for rows.Next() {
+		var s UserSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.Created, &s.LastSeen, &s.Expires); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (usm *SQLiteUserSessionModel) Revoke(ctx context.Context, id string, userID int) error {
+	stmt := `DELETE FROM user_session
+	WHERE
+		id = ?
+		AND user_id = ?`
+
+	_, err := usm.DB.ExecContext(ctx, stmt, id, userID)
+	return err
+}
+
+func (usm *SQLiteUserSessionModel) RevokeOthers(ctx context.Context, id string, userID int) error {
+	stmt := `DELETE FROM user_session
+	WHERE
+		id <> ?
+		AND user_id = ?`
+
+	_, err := usm.DB.ExecContext(ctx, stmt, id, userID)
+	return err
+}
+
+func (usm *SQLiteUserSessionModel) Count(ctx context.Context) (int, error) {
+	stmt := `SELECT COUNT(*)
+	FROM user_session
+	WHERE expires > ?`
+
+	var n int
+	if err := usm.DB.QueryRowContext(ctx, stmt, sqliteNow()).Scan(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (usm *SQLiteUserSessionModel) DeleteExpired(ctx context.Context) (int, error) {
+	stmt := `DELETE FROM user_session
+	WHERE expires <= ?`
+
+	res, err := usm.DB.ExecContext(ctx, stmt, sqliteNow())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+type SQLiteRateLimitModel struct {
+	DB *sql.DB
+}
+
+func (rlm *SQLiteRateLimitModel) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	tx, err := rlm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT tokens, updated
+	FROM rate_limit
+	WHERE key = ?`
+
+	b := tokenBucket{tokens: float64(burst)}
+	err = tx.QueryRowContext(ctx, stmt, key).Scan(&b.tokens, &b.updated)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, 0, err
+	}
+
+	now := sqliteNow()
+	ok, retryAfter := b.take(now, rate, burst)
+
+	stmt = `INSERT INTO rate_limit (key, tokens, updated)
+	VALUES(?, ?, ?)
+	ON CONFLICT (key) DO UPDATE SET tokens = excluded.tokens, updated = excluded.updated`
+
+	if _, err := tx.ExecContext(ctx, stmt, key, b.tokens, now); err != nil {
+		return false, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, 0, err
+	}
+
+	return ok, retryAfter, nil
+}
+
+func (rlm *SQLiteRateLimitModel) DeleteIdle(ctx context.Context, idle time.Duration) (int, error) {
+	stmt := `DELETE FROM rate_limit
+	WHERE updated <= ?`
+
+	res, err := rlm.DB.ExecContext(ctx, stmt, sqliteNow().Add(-idle))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
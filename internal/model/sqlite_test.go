@@ -0,0 +1,56 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/migration"
+)
+
+// create a SQLite database in a temporary directory with the migrations applied
+func newTestSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "snippetbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migration.NewSQLiteMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestSQLiteSnippetStore(t *testing.T) {
+	testSnippetStore(t, func(t *testing.T) SnippetStore {
+		return &SQLiteSnippetModel{DB: newTestSQLiteDB(t)}
+	})
+}
+
+func TestSQLiteUserStore(t *testing.T) {
+	testUserStore(t, func(t *testing.T) UserStore {
+		return &SQLiteUserModel{DB: newTestSQLiteDB(t), PasswordParams: testArgon2idParams}
+	})
+}
+
+func TestSQLiteUserSessionStore(t *testing.T) {
+	testUserSessionStore(t, func(t *testing.T) (UserSessionStore, UserStore) {
+		db := newTestSQLiteDB(t)
+		return &SQLiteUserSessionModel{DB: db}, &SQLiteUserModel{DB: db, PasswordParams: testArgon2idParams}
+	})
+}
+
+func TestSQLiteRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, func(t *testing.T) RateLimitStore {
+		return &SQLiteRateLimitModel{DB: newTestSQLiteDB(t)}
+	})
+}
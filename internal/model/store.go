@@ -0,0 +1,67 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// SnippetStore stores snippets until they expire
+type SnippetStore interface {
+	// insert a snippet that expires in the given number of days and return its id
+	Insert(ctx context.Context, title string, content string, expires int) (int, error)
+	// return the snippet with this id, ErrNoRecord if it doesn't exist or has expired
+	Get(ctx context.Context, id int) (Snippet, error)
+	// return the 10 most recently created snippets that haven't expired
+	Latest(ctx context.Context) ([]Snippet, error)
+	// delete the snippets that have expired and return how many were deleted
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// UserStore stores users and their credentials
+type UserStore interface {
+	// insert a user, ErrDuplicateEmail if the email is already in use
+	Insert(ctx context.Context, name, email, password string) error
+	// insert a user who signs in only through single sign-on and return its id
+	InsertWithoutPassword(ctx context.Context, name, email string) (int, error)
+	// return the id of the user with these credentials, ErrInvalidCredentials if there is none
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	// check if user with this id exists
+	Check(ctx context.Context, id int) (bool, error)
+	// return the id of the user with this email, ErrNoRecord if there is none
+	IDByEmail(ctx context.Context, email string) (int, error)
+}
+
+// UserSessionStore stores the signed-in sessions of users
+type UserSessionStore interface {
+	// record a new signed-in session for the user that lasts until expires and return its id
+	Insert(ctx context.Context, userID int, userAgent, ip string, expires time.Time) (string, error)
+	// update the last seen time of the session and return the previous one, ErrNoRecord if it doesn't exist or has expired
+	Touch(ctx context.Context, id string, userID int) (time.Time, error)
+	// return all sessions of the user that haven't expired, most recently seen first
+	List(ctx context.Context, userID int) ([]UserSession, error)
+	// revoke the session of the user with this id
+	Revoke(ctx context.Context, id string, userID int) error
+	// revoke every session of the user except the one with this id
+	RevokeOthers(ctx context.Context, id string, userID int) error
+	// return the number of signed-in sessions of all users that haven't expired
+	Count(ctx context.Context) (int, error)
+	// delete the sessions that have expired and return how many were deleted
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// RateLimitStore stores the token buckets of the rate limiter
+type RateLimitStore interface {
+	// take a token from the bucket with this key, which holds up to burst tokens and gains rate tokens per second
+	// a missing bucket is full
+	// return whether a token was taken and, if not, how long until the next one is added
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+	// delete the buckets that haven't been used for the idle duration and return how many were deleted
+	DeleteIdle(ctx context.Context, idle time.Duration) (int, error)
+}
+
+var (
+	_ SnippetStore     = (*SnippetModel)(nil)
+	_ UserStore        = (*UserModel)(nil)
+	_ UserSessionStore = (*UserSessionModel)(nil)
+	_ RateLimitStore   = (*RateLimitModel)(nil)
+)
@@ -0,0 +1,511 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+// the tests in this file check the rules every store implementation must follow
+
+func testSnippetStore(t *testing.T, newStore func(t *testing.T) SnippetStore) {
+	ctx := context.Background()
+
+	t.Run("Get", func(t *testing.T) {
+		s := newStore(t)
+
+		id, err := s.Insert(ctx, "An old silent pond", "An old silent pond...", 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		snippet, err := s.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, snippet.ID, id)
+		assert.Equal(t, snippet.Title, "An old silent pond")
+		assert.Equal(t, snippet.Content, "An old silent pond...")
+		assert.Equal(t, snippet.Expires.Sub(snippet.Created).Hours() >= 6*24, true)
+
+		_, err = s.Get(ctx, id+1)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		s := newStore(t)
+
+		id, err := s.Insert(ctx, "Over the wintry forest", "Over the wintry forest...", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Get(ctx, id)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+		latest, err := s.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 0)
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		s := newStore(t)
+
+		expired, err := s.Insert(ctx, "Over the wintry forest", "Over the wintry forest...", -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid, err := s.Insert(ctx, "An old silent pond", "An old silent pond...", 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := s.DeleteExpired(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 1)
+
+		_, err = s.Get(ctx, expired)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+		_, err = s.Get(ctx, valid)
+		assert.Equal(t, err, nil)
+
+		// ids of deleted snippets aren't reused
+		id, err := s.Insert(ctx, "The lamp once out", "The lamp once out...", 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, id != expired && id != valid, true)
+
+		n, err = s.DeleteExpired(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 0)
+	})
+
+	t.Run("Latest", func(t *testing.T) {
+		s := newStore(t)
+
+		var ids []int
+		for i := range 12 {
+			id, err := s.Insert(ctx, fmt.Sprintf("Snippet %d", i), "content", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+
+		latest, err := s.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(latest), 10)
+		assert.Equal(t, latest[0].ID, ids[11])
+		for i := 1; i < len(latest); i++ {
+			assert.Equal(t, latest[i-1].Created.Before(latest[i].Created), false)
+		}
+	})
+}
+
+func testUserStore(t *testing.T, newStore func(t *testing.T) UserStore) {
+	ctx := context.Background()
+
+	t.Run("Authenticate", func(t *testing.T) {
+		s := newStore(t)
+
+		err := s.Insert(ctx, "Alice", "alice@example.com", "plum tractor sunset")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := s.Authenticate(ctx, "alice@example.com", "plum tractor sunset")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ok, err := s.Check(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, true)
+
+		_, err = s.Authenticate(ctx, "alice@example.com", "wrong password")
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+
+		_, err = s.Authenticate(ctx, "bob@example.com", "plum tractor sunset")
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+	})
+
+	t.Run("Duplicate email", func(t *testing.T) {
+		s := newStore(t)
+
+		err := s.Insert(ctx, "Alice", "alice@example.com", "plum tractor sunset")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Insert(ctx, "Alice", "alice@example.com", "plum tractor sunset")
+		assert.Equal(t, errors.Is(err, ErrDuplicateEmail), true)
+
+		_, err = s.InsertWithoutPassword(ctx, "Alice", "alice@example.com")
+		assert.Equal(t, errors.Is(err, ErrDuplicateEmail), true)
+	})
+
+	t.Run("Concurrent duplicate email", func(t *testing.T) {
+		s := newStore(t)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.InsertWithoutPassword(ctx, "Carol", "carol@example.com")
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		var inserted int
+		for err := range errs {
+			if err == nil {
+				inserted++
+			} else if !errors.Is(err, ErrDuplicateEmail) {
+				t.Fatal(err)
+			}
+		}
+		assert.Equal(t, inserted, 1)
+	})
+
+	t.Run("Without password", func(t *testing.T) {
+		s := newStore(t)
+
+		id, err := s.InsertWithoutPassword(ctx, "Bob", "bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.IDByEmail(ctx, "bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, got, id)
+
+		_, err = s.Authenticate(ctx, "bob@example.com", "")
+		assert.Equal(t, errors.Is(err, ErrInvalidCredentials), true)
+
+		_, err = s.IDByEmail(ctx, "carol@example.com")
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		s := newStore(t)
+
+		ok, err := s.Check(ctx, 1_000_000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, false)
+	})
+}
+
+func testUserSessionStore(t *testing.T, newStore func(t *testing.T) (UserSessionStore, UserStore)) {
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+
+	t.Run("Revoke", func(t *testing.T) {
+		s, us := newStore(t)
+
+		alice, err := us.InsertWithoutPassword(ctx, "Alice", "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob, err := us.InsertWithoutPassword(ctx, "Bob", "bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		laptop, err := s.Insert(ctx, alice, "laptop", "192.0.2.1", later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		phone, err := s.Insert(ctx, alice, "phone", "192.0.2.2", later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tablet, err := s.Insert(ctx, alice, "tablet", "192.0.2.3", later)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.Touch(ctx, laptop, alice); err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := s.List(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 3)
+		assert.Equal(t, sessions[0].ID, laptop)
+		assert.Equal(t, sessions[0].UserAgent, "laptop")
+		assert.Equal(t, sessions[0].IP, "192.0.2.1")
+
+		// sessions of other users can't be touched or revoked
+		_, err = s.Touch(ctx, laptop, bob)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+		if err := s.Revoke(ctx, laptop, bob); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Touch(ctx, laptop, alice); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Revoke(ctx, phone, alice); err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Touch(ctx, phone, alice)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+		if err := s.RevokeOthers(ctx, laptop, alice); err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Touch(ctx, tablet, alice)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+		sessions, err = s.List(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 1)
+		assert.Equal(t, sessions[0].ID, laptop)
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		s, us := newStore(t)
+
+		n, err := s.Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 0)
+
+		alice, err := us.InsertWithoutPassword(ctx, "Alice", "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bob, err := us.InsertWithoutPassword(ctx, "Bob", "bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, userID := range []int{alice, alice, bob} {
+			if _, err := s.Insert(ctx, userID, "laptop", "192.0.2.1", later); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		n, err = s.Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 3)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		s, us := newStore(t)
+
+		alice, err := us.InsertWithoutPassword(ctx, "Alice", "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		live, err := s.Insert(ctx, alice, "laptop", "192.0.2.1", later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expired, err := s.Insert(ctx, alice, "phone", "192.0.2.2", time.Now().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// expired sessions are as good as revoked
+		_, err = s.Touch(ctx, expired, alice)
+		assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+		sessions, err := s.List(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, len(sessions), 1)
+		assert.Equal(t, sessions[0].ID, live)
+
+		n, err := s.Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 1)
+
+		n, err = s.DeleteExpired(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 1)
+
+		n, err = s.DeleteExpired(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 0)
+
+		if _, err := s.Touch(ctx, live, alice); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func testRateLimitStore(t *testing.T, newStore func(t *testing.T) RateLimitStore) {
+	ctx := context.Background()
+	// slow enough not to gain a token during the test
+	const slow = 1e-6
+
+	t.Run("Take", func(t *testing.T) {
+		s := newStore(t)
+
+		for range 2 {
+			ok, _, err := s.Take(ctx, "ip:192.0.2.1", slow, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, ok, true)
+		}
+
+		ok, retryAfter, err := s.Take(ctx, "ip:192.0.2.1", slow, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, false)
+		assert.Equal(t, retryAfter > 0, true)
+
+		// buckets don't share tokens
+		ok, _, err = s.Take(ctx, "ip:192.0.2.2", slow, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, true)
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		s := newStore(t)
+
+		ok, _, err := s.Take(ctx, "user:1", 50, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, true)
+
+		ok, retryAfter, err := s.Take(ctx, "user:1", 50, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, false)
+		assert.Equal(t, retryAfter <= 20*time.Millisecond, true)
+
+		time.Sleep(retryAfter + 10*time.Millisecond)
+		ok, _, err = s.Take(ctx, "user:1", 50, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, true)
+	})
+
+	t.Run("DeleteIdle", func(t *testing.T) {
+		s := newStore(t)
+
+		ok, _, err := s.Take(ctx, "user:1", slow, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, true)
+
+		n, err := s.DeleteIdle(ctx, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 0)
+
+		time.Sleep(10 * time.Millisecond)
+		n, err = s.DeleteIdle(ctx, time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, n, 1)
+
+		// a deleted bucket is full again
+		ok, _, err = s.Take(ctx, "user:1", slow, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ok, true)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		s := newStore(t)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		taken := 0
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				ok, _, err := s.Take(ctx, "ip:192.0.2.1", slow, 5)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok {
+					mu.Lock()
+					taken++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, taken, 5)
+	})
+}
+
+func TestMemorySnippetStore(t *testing.T) {
+	testSnippetStore(t, func(t *testing.T) SnippetStore {
+		return NewMemorySnippetStore()
+	})
+}
+
+func TestMemoryUserStore(t *testing.T) {
+	testUserStore(t, func(t *testing.T) UserStore {
+		return NewMemoryUserStore(testArgon2idParams)
+	})
+}
+
+func TestMemoryUserSessionStore(t *testing.T) {
+	testUserSessionStore(t, func(t *testing.T) (UserSessionStore, UserStore) {
+		return NewMemoryUserSessionStore(), NewMemoryUserStore(testArgon2idParams)
+	})
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, func(t *testing.T) RateLimitStore {
+		return NewMemoryRateLimitStore()
+	})
+}
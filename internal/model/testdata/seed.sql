@@ -0,0 +1,21 @@
+INSERT INTO snippet (title, content, created, expires) VALUES (
+    'An old silent pond',
+    E'An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.\n\n– Matsuo Bashō',
+    CURRENT_TIMESTAMP - INTERVAL '1 day',
+    CURRENT_TIMESTAMP + INTERVAL '364 days'
+);
+
+INSERT INTO snippet (title, content, created, expires) VALUES (
+    'Over the wintry forest',
+    E'Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.\n\n– Natsume Soseki',
+    CURRENT_TIMESTAMP - INTERVAL '8 days',
+    CURRENT_TIMESTAMP - INTERVAL '1 day'
+);
+
+-- the password is "plum tractor sunset", hashed with bcrypt before argon2id was introduced
+INSERT INTO "user" (name, email, hashed_password, created) VALUES (
+    'Alice',
+    'alice@example.com',
+    '$2a$04$.F2Un.tkahE6zD8SKQiUvexKAgSGck6Rhe2pfKbWvWiNxTRr4ESg2',
+    CURRENT_TIMESTAMP - INTERVAL '1 year'
+);
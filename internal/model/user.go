@@ -8,7 +8,6 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
@@ -21,10 +20,12 @@ type User struct {
 
 type UserModel struct {
 	DBPool *pgxpool.Pool
+	// parameters for hashing new passwords
+	PasswordParams Argon2idParams
 }
 
 func (um *UserModel) Insert(ctx context.Context, name, email, password string) error {
-	hashedPW, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashedPW, err := hashPassword(password, um.PasswordParams)
 	if err != nil {
 		return err
 	}
@@ -60,13 +61,21 @@ func (um *UserModel) Authenticate(ctx context.Context, email, password string) (
 		return 0, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(hashedPW, []byte(password)); err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredentials
-		}
+	newHash, err := checkPassword(password, hashedPW, um.PasswordParams)
+	if err != nil {
 		return 0, err
 	}
 
+	if newHash != nil {
+		stmt := `UPDATE "user"
+		SET hashed_password = $1
+		WHERE id = $2`
+
+		if _, err := um.DBPool.Exec(ctx, stmt, newHash, id); err != nil {
+			return 0, err
+		}
+	}
+
 	return id, nil
 }
 
@@ -86,3 +95,41 @@ func (um *UserModel) Check(ctx context.Context, id int) (bool, error) {
 
 	return ok, nil
 }
+
+// insert a user who signs in only through single sign-on
+// the user has no password, so Authenticate never succeeds for them
+func (um *UserModel) InsertWithoutPassword(ctx context.Context, name, email string) (int, error) {
+	stmt := `INSERT INTO "user" (name, email, hashed_password, created)
+	VALUES($1, $2, '', CURRENT_TIMESTAMP)
+	RETURNING id`
+
+	var id int
+	if err := um.DBPool.QueryRow(ctx, stmt, name, email).Scan(&id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" { // postgresql error code: unique_violation
+				return 0, ErrDuplicateEmail
+			}
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// return the id of the user with this email
+func (um *UserModel) IDByEmail(ctx context.Context, email string) (int, error) {
+	stmt := `SELECT id
+	FROM "user"
+	WHERE email = $1`
+
+	var id int
+	if err := um.DBPool.QueryRow(ctx, stmt, email).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UserSession holds the metadata of a signed-in session of a user
+type UserSession struct {
+	ID        string
+	UserID    int
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastSeen  time.Time
+	// when the session cookie expires
+	Expires time.Time
+}
+
+type UserSessionModel struct {
+	DBPool *pgxpool.Pool
+}
+
+// record a new signed-in session for the user that lasts until expires and return its id
+func (usm *UserSessionModel) Insert(ctx context.Context, userID int, userAgent, ip string, expires time.Time) (string, error) {
+	stmt := `INSERT INTO user_session (id, user_id, user_agent, ip, created, last_seen, expires)
+	VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $5)`
+
+	id := rand.Text()
+	if _, err := usm.DBPool.Exec(ctx, stmt, id, userID, userAgent, ip, expires); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// update the last seen time of the session and return the previous one
+// return ErrNoRecord if the session doesn't exist (e.g. it has been revoked) or has expired
+func (usm *UserSessionModel) Touch(ctx context.Context, id string, userID int) (time.Time, error) {
+	stmt := `WITH previous AS (
+		SELECT last_seen
+		FROM user_session
+		WHERE
+			id = $1
+			AND user_id = $2
+	)
+	UPDATE user_session
+	SET last_seen = CURRENT_TIMESTAMP
+	WHERE
+		id = $1
+		AND user_id = $2
+		AND expires > CURRENT_TIMESTAMP
+	RETURNING (SELECT last_seen FROM previous)`
+
+	var lastSeen time.Time
+	if err := usm.DBPool.QueryRow(ctx, stmt, id, userID).Scan(&lastSeen); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, ErrNoRecord
+		}
+		return time.Time{}, err
+	}
+
+	return lastSeen, nil
+}
+
+// return all sessions of the user that haven't expired, most recently seen first
+func (usm *UserSessionModel) List(ctx context.Context, userID int) ([]UserSession, error) {
+	stmt := `SELECT id, user_id, user_agent, ip, created, last_seen, expires
+	FROM user_session
+	WHERE
+		user_id = $1
+		AND expires > CURRENT_TIMESTAMP
+	ORDER BY last_seen DESC`
+
+	rows, err := usm.DBPool.Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := pgx.CollectRows(rows, pgx.RowToStructByName[UserSession])
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// revoke the session of the user with this id
+func (usm *UserSessionModel) Revoke(ctx context.Context, id string, userID int) error {
+	stmt := `DELETE FROM user_session
+	WHERE
+		id = $1
+		AND user_id = $2`
+
+	_, err := usm.DBPool.Exec(ctx, stmt, id, userID)
+	return err
+}
+
+// revoke every session of the user except the one with this id
+func (usm *UserSessionModel) RevokeOthers(ctx context.Context, id string, userID int) error {
+	stmt := `DELETE FROM user_session
+	WHERE
+		id <> $1
+		AND user_id = $2`
+
+	_, err := usm.DBPool.Exec(ctx, stmt, id, userID)
+	return err
+}
+
+func (usm *UserSessionModel) Count(ctx context.Context) (int, error) {
+	stmt := `SELECT COUNT(*)
+	FROM user_session
+	WHERE expires > CURRENT_TIMESTAMP`
+
+	var n int
+	if err := usm.DBPool.QueryRow(ctx, stmt).Scan(&n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (usm *UserSessionModel) DeleteExpired(ctx context.Context) (int, error) {
+	stmt := `DELETE FROM user_session
+	WHERE expires <= CURRENT_TIMESTAMP`
+
+	tag, err := usm.DBPool.Exec(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,128 @@
+// Package sso implements single sign-on with an OpenID Connect identity provider
+// using the authorization code flow with PKCE.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrInvalidState     = errors.New("sso: invalid state")
+	ErrNonceMismatch    = errors.New("sso: nonce mismatch")
+	ErrMissingIDToken   = errors.New("sso: no id_token in token response")
+	ErrEmailNotVerified = errors.New("sso: email is not verified")
+)
+
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// the URL the identity provider redirects back to after the user signed in
+	RedirectURL string
+}
+
+// Provider is an OpenID Connect identity provider
+type Provider struct {
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// create a Provider whose endpoints are found with OpenID Connect discovery
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	p, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &Provider{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}
+	return provider, nil
+}
+
+// Flow holds the secrets of a single sign-in attempt
+// they must be kept on the server (e.g. in the session) until the user comes back
+type Flow struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func NewFlow() Flow {
+	f := Flow{
+		State:    rand.Text(),
+		Nonce:    rand.Text(),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	return f
+}
+
+// check if the state returned by the identity provider is the one of this flow
+func (f Flow) CheckState(state string) bool {
+	return f.State != "" && subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) == 1
+}
+
+// return the URL of the identity provider's sign-in page for this flow
+func (p *Provider) AuthCodeURL(f Flow) string {
+	return p.oauth2.AuthCodeURL(f.State, oidc.Nonce(f.Nonce), oauth2.S256ChallengeOption(f.Verifier))
+}
+
+// Identity is the user signed in at the identity provider
+type Identity struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+// exchange the authorization code of this flow for a verified identity
+func (p *Provider) Exchange(ctx context.Context, code string, f Flow) (Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(f.Verifier))
+	if err != nil {
+		return Identity{}, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, ErrMissingIDToken
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(f.Nonce)) != 1 {
+		return Identity{}, ErrNonceMismatch
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return Identity{}, ErrEmailNotVerified
+	}
+
+	id := Identity{
+		Subject: idToken.Subject,
+		Email:   claims.Email,
+		Name:    claims.Name,
+	}
+	return id, nil
+}
@@ -0,0 +1,98 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+	"github.com/obzva/snippetbox/internal/sso/ssotest"
+)
+
+const (
+	testClientID     = "snippetbox"
+	testClientSecret = "secret"
+	testRedirectURL  = "https://snippetbox.test/user/login/sso/callback"
+)
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		want    Identity
+		wantErr error
+	}{
+		{
+			name:   "Verified email",
+			claims: map[string]any{"email": "alice@example.com", "email_verified": true, "name": "Alice"},
+			want:   Identity{Subject: "1234", Email: "alice@example.com", Name: "Alice"},
+		},
+		{
+			name:    "Unverified email",
+			claims:  map[string]any{"email": "alice@example.com", "email_verified": false},
+			wantErr: ErrEmailNotVerified,
+		},
+		{
+			name:    "Nonce mismatch",
+			claims:  map[string]any{"email": "alice@example.com", "email_verified": true, "nonce": "replayed"},
+			wantErr: ErrNonceMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := ssotest.NewIdP(t, testClientID, tt.claims)
+
+			ctx := context.Background()
+			p, err := NewProvider(ctx, Config{
+				IssuerURL:    idp.URL,
+				ClientID:     testClientID,
+				ClientSecret: testClientSecret,
+				RedirectURL:  testRedirectURL,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := NewFlow()
+			code, state := ssotest.SignIn(t, p.AuthCodeURL(f))
+			assert.Equal(t, f.CheckState(state), true)
+
+			id, err := p.Exchange(ctx, code, f)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			assert.Equal(t, id, tt.want)
+		})
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	idp := ssotest.NewIdP(t, testClientID, map[string]any{"email": "alice@example.com", "email_verified": true})
+
+	ctx := context.Background()
+	p, err := NewProvider(ctx, Config{
+		IssuerURL:    idp.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFlow()
+	code, _ := ssotest.SignIn(t, p.AuthCodeURL(f))
+
+	// an intercepted code is useless without the verifier of the flow
+	_, err = p.Exchange(ctx, code, NewFlow())
+	assert.Equal(t, err != nil, true)
+}
+
+func TestCheckState(t *testing.T) {
+	f := NewFlow()
+
+	assert.Equal(t, f.CheckState(f.State), true)
+	assert.Equal(t, f.CheckState("forged"), false)
+	assert.Equal(t, Flow{}.CheckState(""), false)
+}
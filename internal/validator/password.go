@@ -0,0 +1,243 @@
+package validator
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MinPasswordEntropy is the minimum estimated entropy in bits of an acceptable password
+const MinPasswordEntropy = 40
+
+// BreachedPasswords is a set of SHA-1 hashes of passwords that appeared in data breaches
+// the hashes stay in the file, which is binary searched on every lookup,
+// so that lists too big for memory (e.g. the Pwned Passwords one) can be used
+// it is safe for concurrent use
+type BreachedPasswords struct {
+	f *os.File
+	// width of a record in bytes, the line break included
+	width int64
+	// number of records
+	n int64
+}
+
+// open the breached password list at path
+// each line of the file holds a hex-encoded SHA-1 hash and nothing else, followed by "\n" or "\r\n",
+// so that every record has the same width, and the lines must be sorted by hash
+// the counts of the Pwned Passwords downloads must be stripped first, e.g. with cut -d: -f1
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bp, err := newBreachedPasswords(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("validator: %s: %w", path, err)
+	}
+
+	return bp, nil
+}
+
+func newBreachedPasswords(f *os.File) (*BreachedPasswords, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	bp := &BreachedPasswords{f: f}
+	if fi.Size() == 0 {
+		return bp, nil
+	}
+
+	// the first line tells the width of the records
+	first := make([]byte, hashLineMaxWidth)
+	n, err := f.ReadAt(first, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	i := bytes.IndexByte(first[:n], '\n')
+	if i < 0 || (i != hashHexLen && !(i == hashHexLen+1 && first[i-1] == '\r')) {
+		return nil, errors.New("line 1: not a SHA-1 hash alone on its line")
+	}
+	bp.width = int64(i + 1)
+
+	if fi.Size()%bp.width != 0 {
+		return nil, errors.New("lines are not all of the same width")
+	}
+	bp.n = fi.Size() / bp.width
+
+	// the records can't all be checked without reading the whole file, but the ends tell the wrong files apart
+	lo, err := bp.record(0)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := bp.record(bp.n - 1)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Compare(lo[:], hi[:]) > 0 {
+		return nil, errors.New("hashes are not sorted")
+	}
+
+	return bp, nil
+}
+
+const (
+	// length of a hex-encoded SHA-1 hash
+	hashHexLen = 2 * sha1.Size
+	// the hash followed by "\r\n"
+	hashLineMaxWidth = hashHexLen + 2
+)
+
+// read and decode the i-th record of the file
+func (bp *BreachedPasswords) record(i int64) ([sha1.Size]byte, error) {
+	var h [sha1.Size]byte
+
+	buf := make([]byte, bp.width)
+	if _, err := bp.f.ReadAt(buf, i*bp.width); err != nil {
+		return h, err
+	}
+	if _, err := hex.Decode(h[:], bytes.TrimRight(buf, "\r\n")); err != nil {
+		return h, fmt.Errorf("line %d: %w", i+1, err)
+	}
+
+	return h, nil
+}
+
+// check if the password is in the breached password list
+func (bp *BreachedPasswords) Contains(password string) (bool, error) {
+	target := sha1.Sum([]byte(password))
+
+	// binary search over the records, as sort.Search does
+	lo, hi := int64(0), bp.n
+	for lo < hi {
+		mid := int64(uint64(lo+hi) >> 1)
+		h, err := bp.record(mid)
+		if err != nil {
+			return false, fmt.Errorf("validator: %s: %w", bp.f.Name(), err)
+		}
+
+		switch bytes.Compare(h[:], target[:]) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// close the file of the breached password list
+func (bp *BreachedPasswords) Close() error {
+	return bp.f.Close()
+}
+
+// check if the password is not in the breached password list
+// every password passes if no list is loaded
+func PasswordNotBreached(password string, bp *BreachedPasswords) (bool, error) {
+	if bp == nil {
+		return true, nil
+	}
+	breached, err := bp.Contains(password)
+	return !breached, err
+}
+
+// check if the password doesn't contain any of the personal values (e.g. name or email address)
+// the comparison is case-insensitive and values shorter than 3 runes are ignored
+func PasswordNotPersonal(password string, values ...string) bool {
+	password = strings.ToLower(password)
+
+	var parts []string
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		parts = append(parts, v)
+		parts = append(parts, strings.Fields(v)...)
+		if local, _, ok := strings.Cut(v, "@"); ok {
+			parts = append(parts, local)
+		}
+	}
+
+	for _, p := range parts {
+		if utf8.RuneCountInString(p) < 3 {
+			continue
+		}
+		if strings.Contains(password, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// estimate the entropy of the password in bits
+// each rune adds log2 of the size of the character pool the password draws from,
+// while runes that repeat or continue a sequence (e.g. "aaa", "abc", "321") add a single bit
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r <= unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r <= unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case r <= unicode.MaxASCII && unicode.IsDigit(r):
+			digit = true
+		case r <= unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	bitsPerRune := math.Log2(float64(pool))
+
+	var bits float64
+	prev := rune(-1)
+	for _, r := range password {
+		d := r - prev
+		if prev != -1 && (d == 0 || d == 1 || d == -1) {
+			bits++
+		} else {
+			bits += bitsPerRune
+		}
+		prev = r
+	}
+
+	return bits
+}
+
+// check if the estimated entropy of the password is at least MinPasswordEntropy bits
+func PasswordStrong(password string) bool {
+	return PasswordEntropy(password) >= MinPasswordEntropy
+}
@@ -0,0 +1,200 @@
+package validator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obzva/snippetbox/internal/assert"
+)
+
+// SHA-1 hashes of "password" and "qwerty", sorted
+const (
+	passwordHash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	qwertyHash   = "B1B3773A05C0ED0176787A4F1574FF0075F7521E"
+)
+
+// write the breached password list to a file and open it
+func loadBreachedPasswords(t *testing.T, list string) (*BreachedPasswords, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	bp, err := LoadBreachedPasswords(path)
+	if err == nil {
+		t.Cleanup(func() { bp.Close() })
+	}
+	return bp, err
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	// hashes between the two, so that the search has to go both ways
+	var middle strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&middle, "9%039X\n", i)
+	}
+
+	tests := []struct {
+		name string
+		list string
+	}{
+		{
+			name: "LF",
+			list: passwordHash + "\n" + qwertyHash + "\n",
+		},
+		{
+			name: "CRLF",
+			list: passwordHash + "\r\n" + qwertyHash + "\r\n",
+		},
+		{
+			name: "Lower case",
+			list: strings.ToLower(passwordHash + "\n" + qwertyHash + "\n"),
+		},
+		{
+			name: "Many",
+			list: passwordHash + "\n" + middle.String() + qwertyHash + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp, err := loadBreachedPasswords(t, tt.list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tc := range []struct {
+				password string
+				want     bool
+			}{
+				{"password", false},
+				{"qwerty", false},
+				{"pa55word", true},
+			} {
+				notBreached, err := PasswordNotBreached(tc.password, bp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, notBreached, tc.want)
+			}
+		})
+	}
+
+	notBreached, err := PasswordNotBreached("password", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, notBreached, true)
+}
+
+func TestLoadBreachedPasswordsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+	}{
+		{
+			name: "Unsorted",
+			list: qwertyHash + "\n" + passwordHash + "\n",
+		},
+		{
+			name: "Counts",
+			list: passwordHash + ":9545824\n" + qwertyHash + ":3946737\n",
+		},
+		{
+			name: "Different widths",
+			list: passwordHash + "\n" + qwertyHash + "\r\n",
+		},
+		{
+			name: "Not a hash",
+			list: strings.Repeat("Z", 40) + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadBreachedPasswords(t, tt.list)
+			assert.Equal(t, err != nil, true)
+		})
+	}
+}
+
+func TestPasswordNotPersonal(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{
+			name:     "Unrelated",
+			password: "plum-tractor-sunset",
+			want:     true,
+		},
+		{
+			name:     "Name",
+			password: "ALICE-tractor-sunset",
+			want:     false,
+		},
+		{
+			name:     "Surname",
+			password: "plum-liddell-sunset",
+			want:     false,
+		},
+		{
+			name:     "Email local part",
+			password: "plum-a.liddell1",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PasswordNotPersonal(tt.password, "Alice Liddell", "a.liddell1@example.com")
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
+
+func TestPasswordStrong(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{
+			name:     "Repeated",
+			password: "aaaaaaaaaaaaaaaa",
+			want:     false,
+		},
+		{
+			name:     "Sequence",
+			password: "abcdefgh12345678",
+			want:     false,
+		},
+		{
+			name:     "Short lowercase",
+			password: "kqzmvbte",
+			want:     false,
+		},
+		{
+			name:     "Mixed",
+			password: "kq7Zm!vB",
+			want:     true,
+		},
+		{
+			name:     "Passphrase",
+			password: "plum tractor sunset",
+			want:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, PasswordStrong(tt.password), tt.want)
+		})
+	}
+}
@@ -2,5 +2,8 @@ package ui
 
 import "embed"
 
+// the static files are served with their precompressed variants, run go generate after changing them
+//go:generate go run ../cmd/precompress static
+
 //go:embed "static" "html"
 var Files embed.FS